@@ -0,0 +1,154 @@
+package chat
+
+// Builder builds a Component from a sequence of segments. Each call to Text,
+// Translate, Keybind or Append starts a new segment, and the style methods
+// apply to the most recent segment only.
+//
+// For example:
+//
+//	NewBuilder().Text("Server ").Color(ColorRed).
+//	    Text("closed").Color(ColorRed).Bold().Build()
+type Builder struct {
+	segments []Component
+}
+
+// NewBuilder returns an empty Builder.
+func NewBuilder() *Builder {
+	return &Builder{}
+}
+
+// Append starts a new segment with the component.
+func (b *Builder) Append(component Component) *Builder {
+	b.segments = append(b.segments, component)
+	return b
+}
+
+// Text starts a new segment that displays the text.
+func (b *Builder) Text(text string) *Builder {
+	return b.Append(Text(text))
+}
+
+// Translate starts a new segment that displays the translation of key,
+// formatted with the given arguments.
+func (b *Builder) Translate(key string, with ...Component) *Builder {
+	return b.Append(Translate(key, with...))
+}
+
+// Keybind starts a new segment that displays the key bound to a control.
+func (b *Builder) Keybind(key string) *Builder {
+	return b.Append(Keybind(key))
+}
+
+// current returns the most recent segment, starting an empty one if
+// there are none.
+func (b *Builder) current() *Component {
+	if len(b.segments) == 0 {
+		b.segments = append(b.segments, Component{})
+	}
+
+	return &b.segments[len(b.segments)-1]
+}
+
+// Color sets the color of the current segment.
+func (b *Builder) Color(color Color) *Builder {
+	b.current().Color = color
+	return b
+}
+
+// Font sets the font of the current segment, such as "minecraft:uniform".
+func (b *Builder) Font(font string) *Builder {
+	b.current().Font = font
+	return b
+}
+
+// Decoration turns the decoration on or off for the current segment.
+func (b *Builder) Decoration(decoration Decoration, value bool) *Builder {
+	b.current().SetDecoration(decoration, value)
+	return b
+}
+
+// Bold makes the current segment bold.
+func (b *Builder) Bold() *Builder {
+	return b.Decoration(DecorationBold, true)
+}
+
+// Italic makes the current segment italic.
+func (b *Builder) Italic() *Builder {
+	return b.Decoration(DecorationItalic, true)
+}
+
+// Underlined makes the current segment underlined.
+func (b *Builder) Underlined() *Builder {
+	return b.Decoration(DecorationUnderlined, true)
+}
+
+// Strikethrough makes the current segment struck through.
+func (b *Builder) Strikethrough() *Builder {
+	return b.Decoration(DecorationStrikethrough, true)
+}
+
+// Obfuscated makes the current segment obfuscated (randomly changing
+// characters).
+func (b *Builder) Obfuscated() *Builder {
+	return b.Decoration(DecorationObfuscated, true)
+}
+
+// Insertion sets the text inserted into the chat input when the current
+// segment is shift-clicked.
+func (b *Builder) Insertion(text string) *Builder {
+	b.current().Insertion = text
+	return b
+}
+
+// Click sets the action performed when the current segment is clicked.
+func (b *Builder) Click(action ClickAction, value string) *Builder {
+	b.current().ClickEvent = &ClickEvent{Action: action, Value: value}
+	return b
+}
+
+// OpenURL opens the URL when the current segment is clicked.
+func (b *Builder) OpenURL(url string) *Builder {
+	return b.Click(ClickOpenURL, url)
+}
+
+// RunCommand runs the command when the current segment is clicked.
+func (b *Builder) RunCommand(command string) *Builder {
+	return b.Click(ClickRunCommand, command)
+}
+
+// SuggestCommand fills the chat input with the command when the current
+// segment is clicked.
+func (b *Builder) SuggestCommand(command string) *Builder {
+	return b.Click(ClickSuggestCommand, command)
+}
+
+// CopyToClipboard copies the text to the clipboard when the current segment
+// is clicked.
+func (b *Builder) CopyToClipboard(text string) *Builder {
+	return b.Click(ClickCopyToClipboard, text)
+}
+
+// Hover sets the tooltip shown when the current segment is hovered over.
+func (b *Builder) Hover(action HoverAction, contents interface{}) *Builder {
+	b.current().HoverEvent = &HoverEvent{Action: action, Contents: contents}
+	return b
+}
+
+// HoverText shows the component as a tooltip when the current segment is
+// hovered over.
+func (b *Builder) HoverText(text Component) *Builder {
+	return b.Hover(HoverShowText, text)
+}
+
+// Build returns the built Component. A single segment is returned as is,
+// otherwise the segments are the children of an empty component.
+func (b *Builder) Build() Component {
+	switch len(b.segments) {
+	case 0:
+		return Component{}
+	case 1:
+		return b.segments[0]
+	}
+
+	return Component{Extra: append([]Component(nil), b.segments...)}
+}
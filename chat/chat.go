@@ -42,6 +42,9 @@ const (
 //     Format("&4Hello!")
 //
 // returns "§4Hello!"
+//
+// Format replaces every &, including those that aren't part of a code, see
+// FormatCodes or CodeParser to only convert valid codes.
 func Format(message string) string {
 	return strings.Replace(message, "&", S, -1)
 }
@@ -0,0 +1,163 @@
+package chat
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CodeError is returned by a strict CodeParser when a message contains an
+// unknown formatting code, or ends with a prefix.
+type CodeError struct {
+	// Code is 0 if the message ends with a prefix.
+	Code rune
+	// Offset is the byte offset of the code's prefix in the message.
+	Offset int
+}
+
+func (e *CodeError) Error() string {
+	if e.Code == 0 {
+		return fmt.Sprintf("chat: missing formatting code at offset %d",
+			e.Offset)
+	}
+
+	return fmt.Sprintf("chat: unknown formatting code %q at offset %d",
+		e.Code, e.Offset)
+}
+
+// A CodeParser converts formatting codes written with a prefix character,
+// such as "&4", into legacy § codes. Only prefixes followed by a valid code
+// are converted, and a doubled prefix (such as "&&") is an escape for the
+// prefix itself.
+//
+// Hex colors can be written as "&#RRGGBB" or "&x&R&R&G&G&B&B", and are
+// converted into the §x§R§R§G§G§B§B form.
+type CodeParser struct {
+	// Prefixes are the characters that can start a formatting code.
+	// "&" is used if it is empty.
+	Prefixes string
+	// IgnoreCase also accepts uppercase codes such as "&C". It is off by
+	// default, so that text such as "R&D" is left as is.
+	IgnoreCase bool
+	// Strict causes Parse to return a *CodeError for a prefix followed
+	// by an unknown code or at the end of the message, instead of leaving
+	// it as is.
+	Strict bool
+}
+
+// DefaultCodeParser is the lenient CodeParser for & codes used by
+// FormatCodes.
+var DefaultCodeParser = CodeParser{Prefixes: "&"}
+
+// isCode returns whether the character is a valid (lowercase) legacy code.
+func isCode(code rune) bool {
+	_, isColor := legacyColors[code]
+	_, isDecoration := legacyDecorations[code]
+	return isColor || isDecoration || code == legacyReset
+}
+
+// Parse converts the formatting codes in the message into § codes.
+func (p CodeParser) Parse(message string) (string, error) {
+	prefixes := p.Prefixes
+	if prefixes == "" {
+		prefixes = "&"
+	}
+
+	var result strings.Builder
+	runes := []rune(message)
+	offset := 0
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		next := offset + len(string(r))
+
+		if !strings.ContainsRune(prefixes, r) {
+			result.WriteRune(r)
+			offset = next
+			continue
+		}
+
+		if i+1 >= len(runes) {
+			if p.Strict {
+				return "", &CodeError{Offset: offset}
+			}
+
+			result.WriteRune(r)
+			break
+		}
+
+		code := runes[i+1]
+		if code == '#' || code == 'x' || (p.IgnoreCase && code == 'X') {
+			if hex, n := parseHexCode(runes[i+1:], r); n > 0 {
+				result.WriteString(legacyHexCode(hex))
+				i += n
+				offset = next + len(string(runes[i-n+1:i+1]))
+				continue
+			}
+		}
+
+		switch {
+		case code == r:
+			result.WriteRune(r)
+		case isCode(code) || (p.IgnoreCase && isCode(toLowerCode(code))):
+			result.WriteString(S)
+			result.WriteRune(toLowerCode(code))
+		case p.Strict:
+			return "", &CodeError{Code: code, Offset: offset}
+		default:
+			result.WriteRune(r)
+			offset = next
+			continue
+		}
+
+		i++
+		offset = next + len(string(code))
+	}
+
+	return result.String(), nil
+}
+
+// parseHexCode reads a hex color following a prefix, in either the #RRGGBB
+// or x&R&R&G&G&B&B form, and returns it with the number of runes read.
+func parseHexCode(runes []rune, prefix rune) (Color, int) {
+	if runes[0] == '#' {
+		if len(runes) < 7 {
+			return "", 0
+		}
+
+		for _, digit := range runes[1:7] {
+			if !isHexDigit(digit) {
+				return "", 0
+			}
+		}
+
+		return Color(strings.ToUpper(string(runes[:7]))), 7
+	}
+
+	if len(runes) < 13 {
+		return "", 0
+	}
+
+	hex := make([]rune, 6)
+	for i := range hex {
+		if runes[1+i*2] != prefix || !isHexDigit(runes[2+i*2]) {
+			return "", 0
+		}
+		hex[i] = runes[2+i*2]
+	}
+
+	return Color("#" + strings.ToUpper(string(hex))), 13
+}
+
+// FormatCodes formats the message by converting & codes like "&4" into
+// § codes, like Format. Unlike Format, an & that isn't followed by a valid
+// code is left as is, and "&&" can be used to write a single &.
+//
+// For example:
+//
+//	FormatCodes("&4Tom & Jerry in R&D &&4")
+//
+// returns "§4Tom & Jerry in R&D &4"
+func FormatCodes(message string) string {
+	result, _ := DefaultCodeParser.Parse(message)
+	return result
+}
@@ -0,0 +1,87 @@
+package chat
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCodeParser(t *testing.T) {
+	tests := []struct {
+		parser  CodeParser
+		message string
+		result  string
+	}{
+		{DefaultCodeParser, "&4Tom & Jerry in R&D &&4", "§4Tom & Jerry in R&D &4"},
+		{DefaultCodeParser, "&a&lbold&r", "§a§lbold§r"},
+		{DefaultCodeParser, "&Cupper", "&Cupper"},
+		{DefaultCodeParser, "trailing &", "trailing &"},
+		{DefaultCodeParser, "é&aé", "é§aé"},
+		// Prefixes other than &, which can't be used with the default.
+		{CodeParser{Prefixes: "$%"}, "$aa %bb &cc $$ %%", "§aa §bb &cc $ %"},
+		{CodeParser{Prefixes: "$"}, "$#ff0000red", "§x§f§f§0§0§0§0red"},
+		{CodeParser{IgnoreCase: true}, "&Cred &L&Obold", "§cred §l§obold"},
+		// Hex colors.
+		{DefaultCodeParser, "&#ff8000hex", "§x§f§f§8§0§0§0hex"},
+		{DefaultCodeParser, "&#FF8000hex", "§x§f§f§8§0§0§0hex"},
+		{DefaultCodeParser, "&x&f&f&8&0&0&0hex", "§x§f§f§8§0§0§0hex"},
+		{DefaultCodeParser, "&X&f&f&8&0&0&0hex", "&X§f§f§8§0§0§0hex"},
+		{CodeParser{IgnoreCase: true}, "&X&F&F&8&0&0&0hex",
+			"§x§f§f§8§0§0§0hex"},
+		// Incomplete hex colors are left as is, with any codes in them.
+		{DefaultCodeParser, "&#ff80", "&#ff80"},
+		{DefaultCodeParser, "&#ff80zz", "&#ff80zz"},
+		{DefaultCodeParser, "&x&f&f&8", "&x§f§f§8"},
+		{DefaultCodeParser, "&x&f&f&8&0&0$0", "&x§f§f§8§0§0$0"},
+		{CodeParser{Strict: true}, "&a&&&#123456&x&1&2&3&4&5&6",
+			"§a&§x§1§2§3§4§5§6§x§1§2§3§4§5§6"},
+	}
+
+	for _, test := range tests {
+		result, err := test.parser.Parse(test.message)
+		if err != nil {
+			t.Errorf("%+v.Parse(%q): %v", test.parser, test.message, err)
+			continue
+		}
+
+		if result != test.result {
+			t.Errorf("%+v.Parse(%q) = %q, want %q", test.parser, test.message,
+				result, test.result)
+		}
+	}
+}
+
+func TestCodeParserStrict(t *testing.T) {
+	tests := []struct {
+		parser  CodeParser
+		message string
+		code    rune
+		offset  int
+	}{
+		{CodeParser{Strict: true}, "R&D", 'D', 1},
+		{CodeParser{Strict: true}, "&aTom & Jerry", ' ', 6},
+		{CodeParser{Strict: true}, "é&z", 'z', 2},
+		{CodeParser{Strict: true}, "&#ff80", '#', 0},
+		{CodeParser{Strict: true}, "&x&f&f", 'x', 0},
+		{CodeParser{Strict: true, IgnoreCase: true}, "&C&Y", 'Y', 2},
+		// A prefix at the end of the message is missing its code.
+		{CodeParser{Strict: true}, "trailing &", 0, 9},
+		{CodeParser{Strict: true}, "é&", 0, 2},
+		{CodeParser{Prefixes: "$", Strict: true}, "&a$", 0, 2},
+	}
+
+	for _, test := range tests {
+		_, err := test.parser.Parse(test.message)
+		var codeErr *CodeError
+		if !errors.As(err, &codeErr) {
+			t.Errorf("%+v.Parse(%q): error = %v, want a *CodeError",
+				test.parser, test.message, err)
+			continue
+		}
+
+		if codeErr.Code != test.code || codeErr.Offset != test.offset {
+			t.Errorf("%+v.Parse(%q): error = %q at %d, want %q at %d",
+				test.parser, test.message, codeErr.Code, codeErr.Offset,
+				test.code, test.offset)
+		}
+	}
+}
@@ -0,0 +1,310 @@
+package chat
+
+import (
+	"fmt"
+	"github.com/1lann/beacon/versions"
+	"strconv"
+	"strings"
+)
+
+// HexColorProtocol is the protocol number of 1.16, the first release that
+// displays hex colors. Hex colors are replaced with the nearest named color
+// for older clients, see Component.ForProtocol.
+const HexColorProtocol = 735
+
+// colorValues are the RGB values of the named colors.
+var colorValues = map[Color]uint32{
+	ColorBlack:       0x000000,
+	ColorDarkBlue:    0x0000AA,
+	ColorDarkGreen:   0x00AA00,
+	ColorDarkAqua:    0x00AAAA,
+	ColorDarkRed:     0xAA0000,
+	ColorDarkPurple:  0xAA00AA,
+	ColorGold:        0xFFAA00,
+	ColorGray:        0xAAAAAA,
+	ColorDarkGray:    0x555555,
+	ColorBlue:        0x5555FF,
+	ColorGreen:       0x55FF55,
+	ColorAqua:        0x55FFFF,
+	ColorRed:         0xFF5555,
+	ColorLightPurple: 0xFF55FF,
+	ColorYellow:      0xFFFF55,
+	ColorWhite:       0xFFFFFF,
+}
+
+// RGB returns a hex Color for the red, green and blue values.
+func RGB(r, g, b uint8) Color {
+	return Color(fmt.Sprintf("#%02X%02X%02X", r, g, b))
+}
+
+// ParseColor parses a color name such as "red", or a hex color such as
+// "#FF5555".
+func ParseColor(color string) (Color, error) {
+	result := Color(strings.ToLower(color))
+	if _, found := colorValues[result]; found || result == ColorReset {
+		return result, nil
+	}
+
+	if result.IsHex() {
+		return Color(strings.ToUpper(color)), nil
+	}
+
+	return "", fmt.Errorf("chat: invalid color %q", color)
+}
+
+// IsHex returns whether the color is a hex color, as opposed to a named
+// color.
+func (c Color) IsHex() bool {
+	if len(c) != 7 || c[0] != '#' {
+		return false
+	}
+
+	_, err := strconv.ParseUint(string(c[1:]), 16, 32)
+	return err == nil
+}
+
+// RGB returns the red, green and blue values of the color, or false if
+// the color isn't valid.
+func (c Color) RGB() (r, g, b uint8, ok bool) {
+	value, found := colorValues[c]
+	if !found {
+		if !c.IsHex() {
+			return 0, 0, 0, false
+		}
+
+		parsed, _ := strconv.ParseUint(string(c[1:]), 16, 32)
+		value = uint32(parsed)
+	}
+
+	return uint8(value >> 16), uint8(value >> 8), uint8(value), true
+}
+
+// Nearest returns the named color that is closest to the color. Named
+// colors and invalid colors are returned as is.
+func (c Color) Nearest() Color {
+	r, g, b, ok := c.RGB()
+	if !ok || !c.IsHex() {
+		return c
+	}
+
+	return nearestColor(int(r), int(g), int(b))
+}
+
+// nearestColor returns the named color closest to the RGB values, using a
+// weighted distance that approximates human perception.
+func nearestColor(r, g, b int) Color {
+	var nearest Color
+	best := -1
+
+	for _, code := range "0123456789abcdef" {
+		color := legacyColors[code]
+		value := colorValues[color]
+		dr := r - int(value>>16&0xFF)
+		dg := g - int(value>>8&0xFF)
+		db := b - int(value&0xFF)
+		mean := (r + int(value>>16&0xFF)) / 2
+
+		distance := (512+mean)*dr*dr>>8 + 4*dg*dg + (767-mean)*db*db>>8
+		if best < 0 || distance < best {
+			best = distance
+			nearest = color
+		}
+	}
+
+	return nearest
+}
+
+// Gradient returns a component that displays the text with its characters
+// colored along a gradient between the colors, which are spaced evenly.
+func Gradient(text string, colors ...Color) Component {
+	runes := []rune(text)
+	if len(runes) == 0 || len(colors) == 0 {
+		return Text(text)
+	}
+
+	if len(colors) == 1 {
+		return Component{Text: text, Color: colors[0]}
+	}
+
+	component := Component{}
+	for i, r := range runes {
+		position := 0.0
+		if len(runes) > 1 {
+			position = float64(i) / float64(len(runes)-1)
+		}
+
+		component.Extra = append(component.Extra, Component{
+			Text:  string(r),
+			Color: gradientColor(position, colors),
+		})
+	}
+
+	return component
+}
+
+// gradientColor returns the color at the position (from 0 to 1) along the
+// gradient.
+func gradientColor(position float64, colors []Color) Color {
+	scaled := position * float64(len(colors)-1)
+	i := int(scaled)
+	if i >= len(colors)-1 {
+		i = len(colors) - 2
+	}
+
+	fraction := scaled - float64(i)
+	r1, g1, b1, _ := colors[i].RGB()
+	r2, g2, b2, _ := colors[i+1].RGB()
+
+	mix := func(a, b uint8) uint8 {
+		return uint8(float64(a) + (float64(b)-float64(a))*fraction + 0.5)
+	}
+
+	return RGB(mix(r1, r2), mix(g1, g2), mix(b1, b2))
+}
+
+// Downsample returns a copy of the component with every hex color replaced
+// with the nearest named color.
+func (c Component) Downsample() Component {
+	c.Color = c.Color.Nearest()
+
+	if c.With != nil {
+		with := make([]Component, len(c.With))
+		for i, argument := range c.With {
+			with[i] = argument.Downsample()
+		}
+		c.With = with
+	}
+
+	if c.Extra != nil {
+		extra := make([]Component, len(c.Extra))
+		for i, child := range c.Extra {
+			extra[i] = child.Downsample()
+		}
+		c.Extra = extra
+	}
+
+	if c.HoverEvent != nil {
+		if contents, ok := c.HoverEvent.Contents.(Component); ok {
+			event := *c.HoverEvent
+			event.Contents = contents.Downsample()
+			c.HoverEvent = &event
+		}
+	}
+
+	return c
+}
+
+// ForProtocol returns the component as it should be sent to a client using
+// the protocol number, which downsamples hex colors and marshals hover
+// events with the "value" key for clients older than 1.16.
+func (c Component) ForProtocol(protocolNumber int) Component {
+	if !versions.AtLeast(protocolNumber, HexColorProtocol) {
+		c = c.Downsample()
+	}
+
+	if !versions.AtLeast(protocolNumber, HoverContentsProtocol) {
+		c = c.withHoverValues()
+	}
+
+	return c
+}
+
+// withHoverValues returns a copy of the component with every hover event
+// marshaled with the "value" key.
+func (c Component) withHoverValues() Component {
+	if c.With != nil {
+		with := make([]Component, len(c.With))
+		for i, argument := range c.With {
+			with[i] = argument.withHoverValues()
+		}
+		c.With = with
+	}
+
+	if c.Extra != nil {
+		extra := make([]Component, len(c.Extra))
+		for i, child := range c.Extra {
+			extra[i] = child.withHoverValues()
+		}
+		c.Extra = extra
+	}
+
+	if c.HoverEvent != nil {
+		event := *c.HoverEvent
+		event.value = true
+		if contents, ok := event.Contents.(Component); ok {
+			event.Contents = contents.withHoverValues()
+		}
+		c.HoverEvent = &event
+	}
+
+	return c
+}
+
+// legacyHexColor reads a hex color in the legacy §x§R§R§G§G§B§B form from
+// the runes following the x, and returns it with the number of runes read.
+func legacyHexColor(runes []rune) (Color, int) {
+	if len(runes) < 12 {
+		return "", 0
+	}
+
+	hex := make([]rune, 6)
+	for i := range hex {
+		if runes[i*2] != '§' || !isHexDigit(runes[i*2+1]) {
+			return "", 0
+		}
+		hex[i] = runes[i*2+1]
+	}
+
+	return Color("#" + strings.ToUpper(string(hex))), 12
+}
+
+// legacyHexCode returns the legacy §x§R§R§G§G§B§B form of the hex color.
+func legacyHexCode(color Color) string {
+	var code strings.Builder
+	code.WriteString(S + "x")
+	for _, digit := range strings.ToLower(string(color[1:])) {
+		code.WriteString(S)
+		code.WriteRune(digit)
+	}
+
+	return code.String()
+}
+
+func isHexDigit(r rune) bool {
+	return (r >= '0' && r <= '9') || (r >= 'a' && r <= 'f') ||
+		(r >= 'A' && r <= 'F')
+}
+
+// DownsampleLegacy replaces every hex color in the legacy formatted message
+// with the nearest named color code.
+func DownsampleLegacy(message string) string {
+	if !strings.Contains(message, S+"x") && !strings.Contains(message, S+"X") {
+		return message
+	}
+
+	var result strings.Builder
+	runes := []rune(message)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] == '§' && i+1 < len(runes) && toLowerCode(runes[i+1]) == 'x' {
+			if color, n := legacyHexColor(runes[i+2:]); n > 0 {
+				result.WriteString(legacyColorCode(color.Nearest()))
+				i += 1 + n
+				continue
+			}
+		}
+
+		result.WriteRune(runes[i])
+	}
+
+	return result.String()
+}
+
+// DownsampleLegacyFor is like DownsampleLegacy, but leaves the message as is
+// for clients using a protocol number that supports hex colors.
+func DownsampleLegacyFor(message string, protocolNumber int) string {
+	if versions.AtLeast(protocolNumber, HexColorProtocol) {
+		return message
+	}
+
+	return DownsampleLegacy(message)
+}
@@ -0,0 +1,372 @@
+package chat
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Color is the color of a text Component, which is either one of the named
+// colors below, or a hex color such as "#FF5555" (supported since 1.16).
+type Color string
+
+// The named colors of text components.
+const (
+	ColorBlack       Color = "black"
+	ColorDarkBlue    Color = "dark_blue"
+	ColorDarkGreen   Color = "dark_green"
+	ColorDarkAqua    Color = "dark_aqua"
+	ColorDarkRed     Color = "dark_red"
+	ColorDarkPurple  Color = "dark_purple"
+	ColorGold        Color = "gold"
+	ColorGray        Color = "gray"
+	ColorDarkGray    Color = "dark_gray"
+	ColorBlue        Color = "blue"
+	ColorGreen       Color = "green"
+	ColorAqua        Color = "aqua"
+	ColorRed         Color = "red"
+	ColorLightPurple Color = "light_purple"
+	ColorYellow      Color = "yellow"
+	ColorWhite       Color = "white"
+	ColorReset       Color = "reset"
+)
+
+// Decoration is a formatting style of a text Component that can be turned on
+// or off.
+type Decoration string
+
+// The decorations of text components, named after their JSON keys.
+const (
+	DecorationBold          Decoration = "bold"
+	DecorationItalic        Decoration = "italic"
+	DecorationUnderlined    Decoration = "underlined"
+	DecorationStrikethrough Decoration = "strikethrough"
+	DecorationObfuscated    Decoration = "obfuscated"
+)
+
+// Decorations is every Decoration, in the order of their legacy codes.
+var Decorations = []Decoration{
+	DecorationObfuscated,
+	DecorationBold,
+	DecorationStrikethrough,
+	DecorationUnderlined,
+	DecorationItalic,
+}
+
+// ClickAction is the action performed when a Component is clicked.
+type ClickAction string
+
+// The actions of click events.
+const (
+	ClickOpenURL         ClickAction = "open_url"
+	ClickRunCommand      ClickAction = "run_command"
+	ClickSuggestCommand  ClickAction = "suggest_command"
+	ClickChangePage      ClickAction = "change_page"
+	ClickCopyToClipboard ClickAction = "copy_to_clipboard"
+)
+
+// HoverAction is the kind of tooltip shown when a Component is hovered over.
+type HoverAction string
+
+// The actions of hover events.
+const (
+	HoverShowText   HoverAction = "show_text"
+	HoverShowItem   HoverAction = "show_item"
+	HoverShowEntity HoverAction = "show_entity"
+)
+
+// ClickEvent is performed when a Component is clicked.
+type ClickEvent struct {
+	Action ClickAction `json:"action"`
+	Value  string      `json:"value"`
+}
+
+// HoverContentsProtocol is the protocol number of 1.16, the first release
+// that reads the contents of hover events from the "contents" key. Older
+// clients read them from "value", see Component.ForProtocol.
+const HoverContentsProtocol = 735
+
+// HoverEvent is shown when a Component is hovered over. For HoverShowText,
+// Contents is a Component. For the other actions, Contents is marshaled
+// as is, and is a json.RawMessage when unmarshaled.
+type HoverEvent struct {
+	Action   HoverAction `json:"action"`
+	Contents interface{} `json:"contents"`
+
+	// value is set for clients older than 1.16, which read the contents
+	// from the "value" key instead.
+	value bool
+}
+
+// Component is a JSON text component, used for formatted messages such as
+// the description on the server list menu and disconnect messages.
+//
+// A component displays one of Text, Translate (with the arguments in With)
+// or Keybind, followed by its Extra children. The children inherit the
+// style of their parent, unless they override it.
+type Component struct {
+	Text      string
+	Translate string
+	With      []Component
+	Keybind   string
+
+	// Color, Font and the decorations are inherited from the parent when
+	// they are empty (or nil).
+	Color         Color
+	Font          string
+	Bold          *bool
+	Italic        *bool
+	Underlined    *bool
+	Strikethrough *bool
+	Obfuscated    *bool
+
+	Insertion  string
+	ClickEvent *ClickEvent
+	HoverEvent *HoverEvent
+
+	Extra []Component
+}
+
+// jsonComponent is the JSON representation of a Component.
+type jsonComponent struct {
+	Text      *string     `json:"text,omitempty"`
+	Translate string      `json:"translate,omitempty"`
+	With      []Component `json:"with,omitempty"`
+	Keybind   string      `json:"keybind,omitempty"`
+
+	Color         Color  `json:"color,omitempty"`
+	Font          string `json:"font,omitempty"`
+	Bold          *bool  `json:"bold,omitempty"`
+	Italic        *bool  `json:"italic,omitempty"`
+	Underlined    *bool  `json:"underlined,omitempty"`
+	Strikethrough *bool  `json:"strikethrough,omitempty"`
+	Obfuscated    *bool  `json:"obfuscated,omitempty"`
+
+	Insertion  string      `json:"insertion,omitempty"`
+	ClickEvent *ClickEvent `json:"clickEvent,omitempty"`
+	HoverEvent *HoverEvent `json:"hoverEvent,omitempty"`
+
+	Extra []Component `json:"extra,omitempty"`
+}
+
+// Text returns a Component that displays the text.
+func Text(text string) Component {
+	return Component{Text: text}
+}
+
+// Translate returns a Component that displays the translation of key in the
+// client's language, formatted with the given arguments.
+func Translate(key string, with ...Component) Component {
+	return Component{Translate: key, With: with}
+}
+
+// Keybind returns a Component that displays the key bound to the given
+// control on the client, such as "key.jump".
+func Keybind(key string) Component {
+	return Component{Keybind: key}
+}
+
+// Decoration returns whether the decoration is set on the component, and
+// whether it is turned on. It does not take inheritance into account.
+func (c Component) Decoration(decoration Decoration) (value bool, set bool) {
+	field := c.decoration(decoration)
+	if *field == nil {
+		return false, false
+	}
+
+	return **field, true
+}
+
+// SetDecoration turns the decoration on or off for the component and its
+// children (unless they override it).
+func (c *Component) SetDecoration(decoration Decoration, value bool) {
+	*c.decoration(decoration) = &value
+}
+
+func (c *Component) decoration(decoration Decoration) **bool {
+	switch decoration {
+	case DecorationBold:
+		return &c.Bold
+	case DecorationItalic:
+		return &c.Italic
+	case DecorationUnderlined:
+		return &c.Underlined
+	case DecorationStrikethrough:
+		return &c.Strikethrough
+	case DecorationObfuscated:
+		return &c.Obfuscated
+	}
+
+	panic("chat: unknown decoration " + string(decoration))
+}
+
+// PlainText returns the text displayed by the component and its children,
+// without any formatting. Translate and Keybind components are displayed
+// as their key.
+func (c Component) PlainText() string {
+	var builder strings.Builder
+	c.writePlainText(&builder)
+	return builder.String()
+}
+
+func (c Component) writePlainText(builder *strings.Builder) {
+	switch {
+	case c.Translate != "":
+		builder.WriteString(c.Translate)
+	case c.Keybind != "":
+		builder.WriteString(c.Keybind)
+	default:
+		builder.WriteString(c.Text)
+	}
+
+	for _, child := range c.Extra {
+		child.writePlainText(builder)
+	}
+}
+
+// String returns the component encoded as JSON.
+func (c Component) String() string {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return ""
+	}
+
+	return string(data)
+}
+
+// MarshalJSON implements json.Marshaler.
+func (c Component) MarshalJSON() ([]byte, error) {
+	result := jsonComponent{
+		Translate:     c.Translate,
+		With:          c.With,
+		Keybind:       c.Keybind,
+		Color:         c.Color,
+		Font:          c.Font,
+		Bold:          c.Bold,
+		Italic:        c.Italic,
+		Underlined:    c.Underlined,
+		Strikethrough: c.Strikethrough,
+		Obfuscated:    c.Obfuscated,
+		Insertion:     c.Insertion,
+		ClickEvent:    c.ClickEvent,
+		HoverEvent:    c.HoverEvent,
+		Extra:         c.Extra,
+	}
+
+	// The client requires the text to be present if the component doesn't
+	// display anything else.
+	if c.Text != "" || (c.Translate == "" && c.Keybind == "") {
+		text := c.Text
+		result.Text = &text
+	}
+
+	return json.Marshal(result)
+}
+
+// UnmarshalJSON implements json.Unmarshaler. Like the client, it accepts
+// a string as a text component, and an array as a component followed by its
+// extra children.
+func (c *Component) UnmarshalJSON(data []byte) error {
+	trimmed := strings.TrimSpace(string(data))
+
+	if strings.HasPrefix(trimmed, "\"") {
+		*c = Component{}
+		return json.Unmarshal(data, &c.Text)
+	}
+
+	if strings.HasPrefix(trimmed, "[") {
+		var components []Component
+		if err := json.Unmarshal(data, &components); err != nil {
+			return err
+		}
+
+		*c = Component{}
+		if len(components) > 0 {
+			*c = components[0]
+			c.Extra = append(c.Extra, components[1:]...)
+		}
+
+		return nil
+	}
+
+	var result jsonComponent
+	if err := json.Unmarshal(data, &result); err != nil {
+		return err
+	}
+
+	*c = Component{
+		Translate:     result.Translate,
+		With:          result.With,
+		Keybind:       result.Keybind,
+		Color:         result.Color,
+		Font:          result.Font,
+		Bold:          result.Bold,
+		Italic:        result.Italic,
+		Underlined:    result.Underlined,
+		Strikethrough: result.Strikethrough,
+		Obfuscated:    result.Obfuscated,
+		Insertion:     result.Insertion,
+		ClickEvent:    result.ClickEvent,
+		HoverEvent:    result.HoverEvent,
+		Extra:         result.Extra,
+	}
+
+	if result.Text != nil {
+		c.Text = *result.Text
+	}
+
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler. The contents are marshaled with
+// the "value" key if the event was returned by Component.ForProtocol for a
+// client older than 1.16.
+func (e HoverEvent) MarshalJSON() ([]byte, error) {
+	if e.value {
+		return json.Marshal(struct {
+			Action HoverAction `json:"action"`
+			Value  interface{} `json:"value"`
+		}{e.Action, e.Contents})
+	}
+
+	return json.Marshal(struct {
+		Action   HoverAction `json:"action"`
+		Contents interface{} `json:"contents"`
+	}{e.Action, e.Contents})
+}
+
+// UnmarshalJSON implements json.Unmarshaler, and also accepts the "value"
+// key used by clients older than 1.16.
+func (e *HoverEvent) UnmarshalJSON(data []byte) error {
+	var result struct {
+		Action   HoverAction     `json:"action"`
+		Contents json.RawMessage `json:"contents"`
+		Value    json.RawMessage `json:"value"`
+	}
+
+	if err := json.Unmarshal(data, &result); err != nil {
+		return err
+	}
+
+	contents := result.Contents
+	if contents == nil {
+		contents = result.Value
+	}
+
+	*e = HoverEvent{Action: result.Action}
+	if contents == nil {
+		return nil
+	}
+
+	e.Contents = contents
+
+	if result.Action == HoverShowText {
+		var text Component
+		if err := json.Unmarshal(contents, &text); err != nil {
+			return err
+		}
+
+		e.Contents = text
+	}
+
+	return nil
+}
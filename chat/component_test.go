@@ -0,0 +1,63 @@
+package chat
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestHoverEventForProtocol(t *testing.T) {
+	hover := Text("hover")
+	hover.HoverEvent = &HoverEvent{Action: HoverShowText, Contents: Text("inner")}
+
+	component := Text("text")
+	component.HoverEvent = &HoverEvent{Action: HoverShowText, Contents: hover}
+	component.Extra = []Component{{Text: "child", HoverEvent: &HoverEvent{
+		Action:   HoverShowEntity,
+		Contents: json.RawMessage(`{"id":"1"}`),
+	}}}
+
+	tests := []struct {
+		protocolNumber int
+		json           string
+	}{
+		{HoverContentsProtocol, `{"text":"text","hoverEvent":{"action":` +
+			`"show_text","contents":{"text":"hover","hoverEvent":{"action":` +
+			`"show_text","contents":{"text":"inner"}}}},"extra":[{"text":` +
+			`"child","hoverEvent":{"action":"show_entity","contents":` +
+			`{"id":"1"}}}]}`},
+		{HoverContentsProtocol - 1, `{"text":"text","hoverEvent":{"action":` +
+			`"show_text","value":{"text":"hover","hoverEvent":{"action":` +
+			`"show_text","value":{"text":"inner"}}}},"extra":[{"text":` +
+			`"child","hoverEvent":{"action":"show_entity","value":` +
+			`{"id":"1"}}}]}`},
+	}
+
+	for _, test := range tests {
+		data, err := json.Marshal(component.ForProtocol(test.protocolNumber))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(data) != test.json {
+			t.Errorf("protocol %d: %s, want %s", test.protocolNumber, data,
+				test.json)
+		}
+
+		var decoded Component
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatal(err)
+		}
+
+		if decoded.HoverEvent == nil ||
+			decoded.HoverEvent.Contents.(Component).Text != "hover" {
+			t.Errorf("protocol %d: hover event not decoded from %s",
+				test.protocolNumber, data)
+		}
+	}
+
+	// The component itself is left unchanged.
+	data, _ := json.Marshal(component)
+	if string(data) != tests[0].json {
+		t.Errorf("component changed by ForProtocol: %s", data)
+	}
+}
@@ -0,0 +1,307 @@
+package chat
+
+import (
+	"github.com/1lann/beacon/internal/resize"
+	"github.com/1lann/beacon/versions"
+	"image"
+	"strings"
+)
+
+// The characters used to draw images and QR codes. Half blocks are only used
+// by QR codes and images drawn with ImageOptions.HalfBlocks.
+const (
+	FullBlock  = '█'
+	UpperBlock = '▀'
+	LowerBlock = '▄'
+)
+
+// lineHeight is the height in pixels of each line of text, including the
+// space between lines.
+const lineHeight = 9
+
+// ImageOptions configures how an image is drawn as text.
+type ImageOptions struct {
+	// MaxWidth is the maximum width in pixels of each line when rendered in
+	// the default Minecraft font. It defaults to MOTDWidth.
+	MaxWidth int
+	// MaxLines is the maximum number of lines, or 0 for no limit.
+	MaxLines int
+	// HalfBlocks draws two rows of pixels on each line, using half blocks
+	// where only one of them is opaque. This gives smoother edges to images
+	// with transparent backgrounds, but pixels where both are opaque are
+	// drawn as a full block of their average color.
+	HalfBlocks bool
+	// Background is the color that transparent pixels are blended with. If
+	// it's empty, transparent pixels are left blank.
+	Background Color
+}
+
+// imageCell is a character of an image drawn as text. Blank cells have no
+// glyph.
+type imageCell struct {
+	glyph   rune
+	r, g, b float64
+}
+
+// Image draws the image as text made of colored blocks with hex colors,
+// scaled down to fit within the options and keeping its aspect ratio. The
+// text is only displayed correctly by clients from 1.16, see ImageFor.
+func Image(img image.Image, options ImageOptions) Component {
+	return FromLegacy(drawImage(img, options, false))
+}
+
+// ImageLegacy draws the image as a legacy formatted message, dithered to the
+// 16 named colors so that it can be displayed by any client, such as with
+// ping.DisplayMessage. See Image.
+func ImageLegacy(img image.Image, options ImageOptions) string {
+	return drawImage(img, options, true)
+}
+
+// ImageFor draws the image as text for a client using the protocol number,
+// with hex colors for clients from 1.16 and dithered to the named colors
+// for older clients.
+func ImageFor(img image.Image, options ImageOptions,
+	protocolNumber int) Component {
+	if versions.AtLeast(protocolNumber, HexColorProtocol) {
+		return Image(img, options)
+	}
+
+	return FromLegacy(ImageLegacy(img, options))
+}
+
+// drawImage draws the image as a legacy formatted message, using the named
+// colors if dither is true, or hex colors otherwise.
+func drawImage(img image.Image, options ImageOptions, dither bool) string {
+	cells := imageCells(img, options)
+	if dither {
+		ditherCells(cells)
+	}
+
+	lines := make([]string, len(cells))
+	for i, row := range cells {
+		lines[i] = writeCells(row, dither)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// imageCells scales the image down to the size allowed by the options and
+// returns the characters to draw it with.
+func imageCells(img image.Image, options ImageOptions) [][]imageCell {
+	bounds := img.Bounds()
+	if bounds.Dx() <= 0 || bounds.Dy() <= 0 {
+		return nil
+	}
+
+	maxWidth := options.MaxWidth
+	if maxWidth <= 0 {
+		maxWidth = MOTDWidth
+	}
+
+	cellWidth := GlyphWidth(FullBlock, false)
+	columns := maxWidth / cellWidth
+	if columns > bounds.Dx() {
+		columns = bounds.Dx()
+	}
+
+	// Characters are taller than they are wide, so fewer lines than
+	// columns are needed to keep the aspect ratio.
+	aspect := float64(bounds.Dy()) / float64(bounds.Dx()) *
+		float64(cellWidth) / lineHeight
+	lines := int(float64(columns)*aspect + 0.5)
+	if options.MaxLines > 0 && lines > options.MaxLines {
+		lines = options.MaxLines
+		columns = int(float64(lines)/aspect + 0.5)
+	}
+
+	if columns <= 0 || lines <= 0 {
+		return nil
+	}
+
+	rowsPerLine := 1
+	if options.HalfBlocks {
+		rowsPerLine = 2
+	}
+
+	pixels := resize.Image(img, columns, lines*rowsPerLine)
+	backgroundR, backgroundG, backgroundB, hasBackground :=
+		options.Background.RGB()
+	background := [3]float64{float64(backgroundR), float64(backgroundG),
+		float64(backgroundB)}
+
+	pixel := func(x, y int) (imageCell, bool) {
+		c := pixels.NRGBAAt(x, y)
+		cell := imageCell{glyph: FullBlock, r: float64(c.R), g: float64(c.G),
+			b: float64(c.B)}
+		if !hasBackground {
+			return cell, c.A >= 0x80
+		}
+
+		alpha := float64(c.A) / 0xFF
+		blend := func(value float64, i int) float64 {
+			return value*alpha + background[i]*(1-alpha)
+		}
+
+		cell.r, cell.g, cell.b = blend(cell.r, 0), blend(cell.g, 1),
+			blend(cell.b, 2)
+		return cell, true
+	}
+
+	cells := make([][]imageCell, lines)
+	for y := range cells {
+		cells[y] = make([]imageCell, columns)
+		for x := range cells[y] {
+			top, topOpaque := pixel(x, y*rowsPerLine)
+			if rowsPerLine == 1 {
+				if topOpaque {
+					cells[y][x] = top
+				}
+				continue
+			}
+
+			bottom, bottomOpaque := pixel(x, y*rowsPerLine+1)
+			switch {
+			case topOpaque && bottomOpaque:
+				cells[y][x] = imageCell{glyph: FullBlock, r: (top.r + bottom.r) / 2,
+					g: (top.g + bottom.g) / 2, b: (top.b + bottom.b) / 2}
+			case topOpaque:
+				top.glyph = UpperBlock
+				cells[y][x] = top
+			case bottomOpaque:
+				bottom.glyph = LowerBlock
+				cells[y][x] = bottom
+			}
+		}
+	}
+
+	return cells
+}
+
+// ditherCells replaces the color of each cell with the nearest named color,
+// using Floyd-Steinberg dithering to spread the difference to the
+// neighboring cells.
+func ditherCells(cells [][]imageCell) {
+	spread := func(x, y int, dr, dg, db, weight float64) {
+		if y >= len(cells) || x < 0 || x >= len(cells[y]) ||
+			cells[y][x].glyph == 0 {
+			return
+		}
+
+		cells[y][x].r += dr * weight
+		cells[y][x].g += dg * weight
+		cells[y][x].b += db * weight
+	}
+
+	for y, row := range cells {
+		for x, cell := range row {
+			if cell.glyph == 0 {
+				continue
+			}
+
+			nearest := nearestColor(clampColor(cell.r), clampColor(cell.g),
+				clampColor(cell.b))
+			value := colorValues[nearest]
+			r, g, b := float64(value>>16&0xFF), float64(value>>8&0xFF),
+				float64(value&0xFF)
+			dr, dg, db := cell.r-r, cell.g-g, cell.b-b
+			cells[y][x].r, cells[y][x].g, cells[y][x].b = r, g, b
+
+			spread(x+1, y, dr, dg, db, 7.0/16)
+			spread(x-1, y+1, dr, dg, db, 3.0/16)
+			spread(x, y+1, dr, dg, db, 5.0/16)
+			spread(x+1, y+1, dr, dg, db, 1.0/16)
+		}
+	}
+}
+
+func clampColor(value float64) int {
+	if value < 0 {
+		return 0
+	} else if value > 0xFF {
+		return 0xFF
+	}
+
+	return int(value + 0.5)
+}
+
+// writeCells writes a line of cells as a legacy formatted message, with
+// the cells colored with the nearest named color if named is true, or hex
+// colors otherwise. Blank cells are drawn with spaces so that the columns
+// of every line line up.
+func writeCells(row []imageCell, named bool) string {
+	for len(row) > 0 && row[len(row)-1].glyph == 0 {
+		row = row[:len(row)-1]
+	}
+
+	var builder strings.Builder
+	var current Color
+	cellWidth := GlyphWidth(FullBlock, false)
+	drawn := 0
+
+	for x := 0; x < len(row); x++ {
+		if row[x].glyph == 0 {
+			end := x
+			for row[end].glyph == 0 {
+				end++
+			}
+
+			spaces, width := blankSpaces(end*cellWidth - drawn)
+			if strings.Contains(spaces, S) {
+				// Bold spaces leave the text bold, so the color needs to be
+				// set again to reset it.
+				current = ""
+			}
+
+			builder.WriteString(spaces)
+			drawn += width
+			x = end - 1
+			continue
+		}
+
+		color := RGB(uint8(clampColor(row[x].r)), uint8(clampColor(row[x].g)),
+			uint8(clampColor(row[x].b)))
+		if named {
+			color = color.Nearest()
+		}
+
+		if color != current {
+			builder.WriteString(legacyColorCode(color))
+			current = color
+		}
+
+		builder.WriteRune(row[x].glyph)
+		drawn += GlyphWidth(row[x].glyph, false)
+	}
+
+	return builder.String()
+}
+
+// blankSpaces returns the spaces whose width is closest to the width in
+// pixels, using bold spaces which are a pixel wider as needed, with their
+// total width.
+func blankSpaces(width int) (string, int) {
+	spaceWidth := GlyphWidth(' ', false)
+	boldWidth := GlyphWidth(' ', true)
+
+	bestSpaces, bestBold, bestWidth := 0, 0, 0
+	for bold := 0; bold < spaceWidth; bold++ {
+		for spaces := 0; ; spaces++ {
+			total := spaces*spaceWidth + bold*boldWidth
+			if total > width+spaceWidth {
+				break
+			}
+
+			if absInt(width-total) < absInt(width-bestWidth) {
+				bestSpaces, bestBold, bestWidth = spaces, bold, total
+			}
+		}
+	}
+
+	result := strings.Repeat(" ", bestSpaces)
+	if bestBold > 0 {
+		result += legacyDecorationCode(DecorationBold) +
+			strings.Repeat(" ", bestBold)
+	}
+
+	return result, bestWidth
+}
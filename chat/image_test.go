@@ -0,0 +1,126 @@
+package chat
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestBlankSpaces(t *testing.T) {
+	tests := []struct {
+		width  int
+		spaces string
+		drawn  int
+	}{
+		{0, "", 0},
+		{2, "", 0},
+		{3, " ", 4},
+		{5, "§l ", 5},
+		// A single cell is a pixel wider than a bold space.
+		{6, "§l ", 5},
+		{9, " §l ", 9},
+		{12, "   ", 12},
+		{13, "  §l ", 13},
+		{18, "  §l  ", 18},
+		{19, " §l   ", 19},
+	}
+
+	for _, test := range tests {
+		spaces, drawn := blankSpaces(test.width)
+		if spaces != test.spaces || drawn != test.drawn {
+			t.Errorf("blankSpaces(%d) = %q, %d, want %q, %d", test.width,
+				spaces, drawn, test.spaces, test.drawn)
+		}
+	}
+}
+
+func TestWriteCells(t *testing.T) {
+	red := imageCell{glyph: FullBlock, r: 0xFF, g: 0x55, b: 0x55}
+	dark := imageCell{glyph: LowerBlock, r: 0x10, g: 0x20, b: 0x30}
+	blank := imageCell{}
+
+	tests := []struct {
+		row   []imageCell
+		named bool
+		line  string
+	}{
+		{[]imageCell{red, red, dark}, false,
+			"§x§f§f§5§5§5§5██§x§1§0§2§0§3§0▄"},
+		{[]imageCell{red, red, dark}, true, "§c██§0▄"},
+		// Bold spaces need the color to be set again to turn bold off.
+		{[]imageCell{red, blank, red}, true, "§c█§l §c█"},
+		{[]imageCell{red, blank, blank, red}, true, "§c█   █"},
+		// Gaps make up for the columns of previous gaps being drawn a pixel
+		// short.
+		{[]imageCell{blank, red, blank, blank, blank, red}, false,
+			"§l §x§f§f§5§5§5§5█ §l   §x§f§f§5§5§5§5█"},
+		// Trailing blank cells are left out.
+		{[]imageCell{red, blank, blank}, true, "§c█"},
+		{[]imageCell{blank}, true, ""},
+	}
+
+	for _, test := range tests {
+		if line := writeCells(test.row, test.named); line != test.line {
+			t.Errorf("writeCells(%v, %v) = %q, want %q", test.row, test.named,
+				line, test.line)
+		}
+	}
+}
+
+// testImage returns a 4x6 image, which is drawn as 4 lines of 4 cells.
+func testImage() image.Image {
+	red := color.NRGBA{0xFF, 0x00, 0x00, 0xFF}
+	gray := color.NRGBA{0x80, 0x80, 0x80, 0xFF}
+	clear := color.NRGBA{}
+
+	rows := [][]color.Color{
+		{red, clear, red, clear},
+		{red, clear, red, clear},
+		{gray, gray, gray, gray},
+		{gray, gray, gray, gray},
+		{clear, clear, clear, red},
+		{clear, clear, clear, red},
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 6))
+	for y, row := range rows {
+		for x, c := range row {
+			img.Set(x, y, c)
+		}
+	}
+
+	return img
+}
+
+func TestImageLegacy(t *testing.T) {
+	tests := []struct {
+		options ImageOptions
+		message string
+	}{
+		// The second line averages the red and gray rows, and the gray
+		// line is dithered between gray and dark gray.
+		{ImageOptions{}, "§4█§l §4█\n§c█§l §c█\n§8█§7█§8█§7█\n  §l  §4█"},
+		{ImageOptions{HalfBlocks: true},
+			"§4█§l §4█\n§c█§8▄§c█§8▄\n§8█§7██§8█\n  §l  §4█"},
+		{ImageOptions{Background: ColorWhite},
+			"§4█§f█§4█§f█\n§c█§7█§c█§7█\n§8█§7█§8█§7█\n§f███§4█"},
+		{ImageOptions{MaxLines: 2}, "§c█§4█\n§l §c█"},
+		{ImageOptions{MaxWidth: 12}, "§c█§4█\n§l §c█"},
+	}
+
+	for _, test := range tests {
+		if message := ImageLegacy(testImage(), test.options); message !=
+			test.message {
+			t.Errorf("ImageLegacy(%+v) = %q, want %q", test.options, message,
+				test.message)
+		}
+	}
+
+	const hex = "§x§f§f§0§0§0§0█§l §x§f§f§0§0§0§0█\n" +
+		"§x§c§0§4§0§4§0█§l §x§c§0§4§0§4§0█\n§x§8§0§8§0§8§0████\n" +
+		"  §l  §x§f§f§0§0§0§0█"
+	if message := drawImage(testImage(), ImageOptions{}, false); message !=
+		hex {
+		t.Errorf("drawImage() = %q, want %q", message, hex)
+	}
+}
@@ -0,0 +1,260 @@
+package chat
+
+import (
+	"strings"
+)
+
+// legacyColors maps legacy color codes to the colors of text components.
+var legacyColors = map[rune]Color{
+	'0': ColorBlack,
+	'1': ColorDarkBlue,
+	'2': ColorDarkGreen,
+	'3': ColorDarkAqua,
+	'4': ColorDarkRed,
+	'5': ColorDarkPurple,
+	'6': ColorGold,
+	'7': ColorGray,
+	'8': ColorDarkGray,
+	'9': ColorBlue,
+	'a': ColorGreen,
+	'b': ColorAqua,
+	'c': ColorRed,
+	'd': ColorLightPurple,
+	'e': ColorYellow,
+	'f': ColorWhite,
+}
+
+// legacyDecorations maps legacy formatting codes to decorations.
+var legacyDecorations = map[rune]Decoration{
+	'k': DecorationObfuscated,
+	'l': DecorationBold,
+	'm': DecorationStrikethrough,
+	'n': DecorationUnderlined,
+	'o': DecorationItalic,
+}
+
+// legacyReset is the legacy code that resets the color and decorations.
+const legacyReset = 'r'
+
+// style is the effective style of text, after inheritance.
+type style struct {
+	color       Color
+	decorations map[Decoration]bool
+}
+
+func (s style) with(component Component) style {
+	result := style{color: s.color, decorations: make(map[Decoration]bool)}
+	for decoration, value := range s.decorations {
+		result.decorations[decoration] = value
+	}
+
+	if component.Color == ColorReset {
+		result.color = ""
+	} else if component.Color != "" {
+		result.color = component.Color
+	}
+
+	for _, decoration := range Decorations {
+		if value, set := component.Decoration(decoration); set {
+			result.decorations[decoration] = value
+		}
+	}
+
+	return result
+}
+
+// includes returns whether every decoration of other is also turned on in s.
+func (s style) includes(other style) bool {
+	for decoration, value := range other.decorations {
+		if value && !s.decorations[decoration] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (s style) equals(other style) bool {
+	return s.color == other.color && s.includes(other) && other.includes(s)
+}
+
+// component returns a text component with the style set explicitly.
+func (s style) component(text string) Component {
+	component := Component{Text: text, Color: s.color}
+	for _, decoration := range Decorations {
+		if s.decorations[decoration] {
+			component.SetDecoration(decoration, true)
+		}
+	}
+
+	return component
+}
+
+// FromLegacy converts a message formatted with legacy § codes into a text
+// component. Like the client, a color code turns off any decorations, and
+// unknown codes are removed. Hex colors are read in the §x§R§R§G§G§B§B form
+// used by many server implementations.
+func FromLegacy(message string) Component {
+	var segments []Component
+	current := style{decorations: make(map[Decoration]bool)}
+	var text strings.Builder
+
+	flush := func() {
+		if text.Len() > 0 {
+			segments = append(segments, current.component(text.String()))
+			text.Reset()
+		}
+	}
+
+	runes := []rune(message)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != '§' || i+1 >= len(runes) {
+			text.WriteRune(runes[i])
+			continue
+		}
+
+		i++
+		code := toLowerCode(runes[i])
+
+		if code == 'x' {
+			if color, n := legacyHexColor(runes[i+1:]); n > 0 {
+				flush()
+				current = style{color: color, decorations: make(map[Decoration]bool)}
+				i += n
+			}
+		} else if color, found := legacyColors[code]; found {
+			flush()
+			current = style{color: color, decorations: make(map[Decoration]bool)}
+		} else if decoration, found := legacyDecorations[code]; found {
+			if !current.decorations[decoration] {
+				flush()
+				current = current.with(Component{})
+				current.decorations[decoration] = true
+			}
+		} else if code == legacyReset {
+			flush()
+			current = style{decorations: make(map[Decoration]bool)}
+		}
+	}
+
+	flush()
+
+	switch len(segments) {
+	case 0:
+		return Text("")
+	case 1:
+		return segments[0]
+	}
+
+	return Component{Extra: segments}
+}
+
+// toLowerCode returns the lowercase form of a legacy code character, as the
+// codes are case insensitive.
+func toLowerCode(code rune) rune {
+	if code >= 'A' && code <= 'Z' {
+		return code + 'a' - 'A'
+	}
+
+	return code
+}
+
+// ToLegacy converts the text component into the shortest equivalent message
+// formatted with legacy § codes, with hex colors in the §x§R§R§G§G§B§B form.
+// Features that can't be represented, such as fonts and events, are
+// dropped, and translated and keybind components are represented by
+// their key.
+func ToLegacy(component Component) string {
+	var builder strings.Builder
+	current := style{decorations: make(map[Decoration]bool)}
+	writeLegacy(&builder, component, current, &current)
+	return builder.String()
+}
+
+// ToLegacy converts the component into a message formatted with legacy
+// § codes. See ToLegacy.
+func (c Component) ToLegacy() string {
+	return ToLegacy(c)
+}
+
+func writeLegacy(builder *strings.Builder, component Component,
+	parent style, current *style) {
+	effective := parent.with(component)
+
+	text := component.Text
+	if component.Translate != "" {
+		text = component.Translate
+	} else if component.Keybind != "" {
+		text = component.Keybind
+	}
+
+	if text != "" {
+		builder.WriteString(legacyTransition(*current, effective))
+		builder.WriteString(text)
+		*current = effective
+	}
+
+	for _, child := range component.Extra {
+		writeLegacy(builder, child, effective, current)
+	}
+}
+
+// legacyTransition returns the shortest sequence of legacy codes that
+// changes the style of text from one style to another.
+func legacyTransition(from style, to style) string {
+	if from.equals(to) {
+		return ""
+	}
+
+	var codes strings.Builder
+	if from.color == to.color && to.includes(from) {
+		for _, decoration := range Decorations {
+			if to.decorations[decoration] && !from.decorations[decoration] {
+				codes.WriteString(legacyDecorationCode(decoration))
+			}
+		}
+
+		return codes.String()
+	}
+
+	if to.color == "" {
+		codes.WriteString(S + string(legacyReset))
+	} else {
+		codes.WriteString(legacyColorCode(to.color))
+	}
+
+	for _, decoration := range Decorations {
+		if to.decorations[decoration] {
+			codes.WriteString(legacyDecorationCode(decoration))
+		}
+	}
+
+	return codes.String()
+}
+
+// legacyColorCode returns the legacy code for the color, which is in the
+// §x§R§R§G§G§B§B form for hex colors.
+func legacyColorCode(color Color) string {
+	if color.IsHex() {
+		return legacyHexCode(color)
+	}
+
+	for code, legacyColor := range legacyColors {
+		if legacyColor == color {
+			return S + string(code)
+		}
+	}
+
+	return S + string(legacyReset)
+}
+
+// legacyDecorationCode returns the legacy code for the decoration.
+func legacyDecorationCode(decoration Decoration) string {
+	for code, legacyDecoration := range legacyDecorations {
+		if legacyDecoration == decoration {
+			return S + string(code)
+		}
+	}
+
+	return ""
+}
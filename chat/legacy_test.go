@@ -0,0 +1,71 @@
+package chat
+
+import (
+	"testing"
+)
+
+func TestLegacyRoundTrip(t *testing.T) {
+	tests := []struct {
+		message string
+		legacy  string
+	}{
+		{"hello", "hello"},
+		{"§ahello", "§ahello"},
+		{"§Ahello", "§ahello"},
+		{"§a§a§ahi", "§ahi"},
+		{"§l§lhi", "§lhi"},
+		{"§zunknown", "unknown"},
+		{"trailing§", "trailing§"},
+		// Color codes turn off decorations.
+		{"§lbold §cred", "§lbold §cred"},
+		{"§a§l§oa§mb§cc", "§a§l§oa§mb§cc"},
+		// Hex colors.
+		{"§x§f§f§0§0§0§0hex", "§x§f§f§0§0§0§0hex"},
+		{"§X§F§F§8§0§0§0hex", "§x§f§f§8§0§0§0hex"},
+		{"§x§1§2§3§4§5§6§lhex bold§r§7gray", "§x§1§2§3§4§5§6§lhex bold§7gray"},
+		{"§x§1§2§3§4§5§6", ""},
+		{"§x§1§2partial", "§2partial"},
+		// Resets.
+		{"§a§lgreen bold§r plain", "§a§lgreen bold§r plain"},
+		{"§ahi§r", "§ahi"},
+		{"§l§ra", "a"},
+		{"§aa§r§ab", "§aab"},
+	}
+
+	for _, test := range tests {
+		legacy := FromLegacy(test.message).ToLegacy()
+		if legacy != test.legacy {
+			t.Errorf("FromLegacy(%q).ToLegacy() = %q, want %q", test.message,
+				legacy, test.legacy)
+		}
+
+		if again := FromLegacy(legacy).ToLegacy(); again != legacy {
+			t.Errorf("FromLegacy(%q).ToLegacy() = %q, want it unchanged",
+				legacy, again)
+		}
+	}
+}
+
+func TestLegacyNestedStyles(t *testing.T) {
+	bold := Text("bold")
+	bold.SetDecoration(DecorationBold, true)
+	notBold := Text(" not")
+	notBold.SetDecoration(DecorationBold, false)
+	bold.Extra = []Component{notBold, {Text: " reset", Color: ColorReset}}
+
+	component := Component{
+		Text:  "gold ",
+		Color: ColorGold,
+		Extra: []Component{bold, Text(" gold"), {Text: " hex", Color: "#123456"}},
+	}
+
+	const legacy = "§6gold §lbold§6 not§r§l reset§6 gold§x§1§2§3§4§5§6 hex"
+	if result := component.ToLegacy(); result != legacy {
+		t.Fatalf("ToLegacy() = %q, want %q", result, legacy)
+	}
+
+	if result := FromLegacy(legacy).ToLegacy(); result != legacy {
+		t.Errorf("FromLegacy(%q).ToLegacy() = %q, want it unchanged", legacy,
+			result)
+	}
+}
@@ -0,0 +1,626 @@
+package chat
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+// MarkupError is returned by ParseMarkup for invalid markup, and describes
+// where in the markup the error is.
+type MarkupError struct {
+	// Offset is the byte offset of the error in the markup.
+	Offset int
+	// Line and Column are the 1-based position of the error, with the
+	// column counted in characters.
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e *MarkupError) Error() string {
+	return fmt.Sprintf("chat: markup error at line %d, column %d: %s",
+		e.Line, e.Column, e.Message)
+}
+
+// markupNode is a tag that is currently open while parsing markup.
+type markupNode struct {
+	name      string
+	component Component
+	// colors is the gradient applied to the text of the tag when it's
+	// closed, if any.
+	colors  []Color
+	rainbow bool
+}
+
+type markupParser struct {
+	markup string
+	// positions are the offsets within the markup originally passed to
+	// ParseMarkup of each byte of markup and its end, for arguments that are
+	// parsed as markup themselves, which may have had quotes and escapes
+	// removed. It's nil for the original markup.
+	positions []int
+	full      string
+	stack     []*markupNode
+	text      strings.Builder
+}
+
+// ParseMarkup parses a message written in a tag based markup similar to
+// MiniMessage into a text component. For example:
+//
+//	<red>Server <bold>closed</bold></red> <click:open_url:'https://…'>info</click>
+//
+// The supported tags are:
+//
+//   - colors by name (<red>), as hex (<#FF5555>), or as <color:red>
+//   - decorations: <bold> (<b>), <italic> (<i>, <em>), <underlined> (<u>),
+//     <strikethrough> (<st>) and <obfuscated> (<obf>), which can be turned
+//     off with a ! such as <!italic>
+//   - <click:action:value>, <hover:show_text:'markup'>, <insert:text> and
+//     <font:name>
+//   - <gradient:color:color...> and <rainbow>
+//   - <key:name>, <lang:key:argument...> (or <tr>), and <newline> (<br>)
+//   - <reset>, which closes every open tag
+//
+// Tags are closed with </name>, which also closes any tags opened after it,
+// and tags left open are closed at the end of the markup. Arguments that
+// contain a : or > can be quoted with ' or ", and a \ escapes the next
+// character, such as \< for a literal <.
+func ParseMarkup(markup string) (Component, error) {
+	return parseMarkup(markup, markup, nil)
+}
+
+func parseMarkup(full string, markup string, positions []int) (Component,
+	error) {
+	p := &markupParser{
+		markup:    markup,
+		positions: positions,
+		full:      full,
+		stack:     []*markupNode{{}},
+	}
+
+	if err := p.parse(); err != nil {
+		return Component{}, err
+	}
+
+	p.closeTo(1)
+	root := p.stack[0].component
+	if len(root.Extra) == 1 {
+		return root.Extra[0], nil
+	}
+
+	return root, nil
+}
+
+// position returns the offset within the original markup of the offset
+// within p.markup.
+func (p *markupParser) position(offset int) int {
+	if p.positions == nil {
+		return offset
+	}
+
+	return p.positions[offset]
+}
+
+// argumentMarkup returns the arguments joined by joinArguments, and the
+// positions of its bytes within the original markup, to be parsed as markup.
+func (p *markupParser) argumentMarkup(arguments []markupArgument) (string,
+	[]int) {
+	var positions []int
+	for _, argument := range arguments {
+		for _, position := range argument.positions {
+			positions = append(positions, p.position(position))
+		}
+	}
+
+	return joinArguments(arguments), positions
+}
+
+// errorAt returns a *MarkupError at the offset within p.markup.
+func (p *markupParser) errorAt(offset int, format string,
+	args ...interface{}) error {
+	offset = p.position(offset)
+	before := p.full[:offset]
+	line := strings.Count(before, "\n") + 1
+	column := utf8.RuneCountInString(before[strings.LastIndex(before, "\n")+1:])
+
+	return &MarkupError{
+		Offset:  offset,
+		Line:    line,
+		Column:  column + 1,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+func (p *markupParser) top() *markupNode {
+	return p.stack[len(p.stack)-1]
+}
+
+// flush appends the pending text to the innermost open tag.
+func (p *markupParser) flush() {
+	if p.text.Len() == 0 {
+		return
+	}
+
+	top := p.top()
+	top.component.Extra = append(top.component.Extra, Text(p.text.String()))
+	p.text.Reset()
+}
+
+// closeTo closes tags until only depth tags remain open.
+func (p *markupParser) closeTo(depth int) {
+	p.flush()
+	for len(p.stack) > depth {
+		node := p.top()
+		p.stack = p.stack[:len(p.stack)-1]
+
+		if node.colors != nil || node.rainbow {
+			total := countGradientRunes(node.component)
+			index := 0
+			node.component = applyGradient(node.component, node, total, &index)
+		}
+
+		parent := p.top()
+		parent.component.Extra = append(parent.component.Extra, node.component)
+	}
+}
+
+func (p *markupParser) parse() error {
+	markup := p.markup
+	for i := 0; i < len(markup); {
+		r, size := utf8.DecodeRuneInString(markup[i:])
+
+		if r == '\\' && i+size < len(markup) {
+			escaped, escapedSize := utf8.DecodeRuneInString(markup[i+size:])
+			if escaped == '<' || escaped == '\\' {
+				p.text.WriteRune(escaped)
+				i += size + escapedSize
+				continue
+			}
+		}
+
+		if r == '<' && i+1 < len(markup) && isTagStart(markup[i+1]) {
+			end, err := p.findTagEnd(i)
+			if err != nil {
+				return err
+			}
+
+			if err := p.handleTag(i, markup[i+1:end]); err != nil {
+				return err
+			}
+
+			i = end + 1
+			continue
+		}
+
+		p.text.WriteRune(r)
+		i += size
+	}
+
+	return nil
+}
+
+func isTagStart(b byte) bool {
+	return (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z') || b == '#' ||
+		b == '!' || b == '/'
+}
+
+// findTagEnd returns the offset of the > that closes the tag starting at
+// start, skipping over quoted arguments.
+func (p *markupParser) findTagEnd(start int) (int, error) {
+	var quote byte
+	for i := start + 1; i < len(p.markup); i++ {
+		b := p.markup[i]
+		switch {
+		case quote != 0 && b == '\\':
+			i++
+		case quote != 0 && b == quote:
+			quote = 0
+		case quote != 0:
+		case b == '\'' || b == '"':
+			quote = b
+		case b == '>':
+			return i, nil
+		}
+	}
+
+	if quote != 0 {
+		return 0, p.errorAt(start, "unterminated quote in tag")
+	}
+
+	return 0, p.errorAt(start, "unterminated tag")
+}
+
+// markupArgument is an argument of a tag, with its offset in the markup.
+type markupArgument struct {
+	value  string
+	offset int
+	// positions are the offsets in the markup of each byte of value, and
+	// of the : or > after it.
+	positions []int
+}
+
+// splitTag splits the contents of a tag into its arguments, removing quotes
+// and escapes.
+func splitTag(contents string, offset int) []markupArgument {
+	var arguments []markupArgument
+	var current strings.Builder
+	var positions []int
+	var quote byte
+	start := offset
+
+	write := func(i int) {
+		current.WriteByte(contents[i])
+		positions = append(positions, offset+i)
+	}
+
+	for i := 0; i < len(contents); i++ {
+		b := contents[i]
+		switch {
+		case quote != 0 && b == '\\' && i+1 < len(contents):
+			i++
+			write(i)
+		case quote != 0 && b == quote:
+			quote = 0
+		case quote != 0:
+			write(i)
+		case b == '\'' || b == '"':
+			quote = b
+			if current.Len() == 0 {
+				start = offset + i + 1
+			}
+		case b == ':':
+			arguments = append(arguments, markupArgument{current.String(),
+				start, append(positions, offset+i)})
+			current.Reset()
+			positions = nil
+			start = offset + i + 1
+		default:
+			write(i)
+		}
+	}
+
+	return append(arguments, markupArgument{current.String(), start,
+		append(positions, offset+len(contents))})
+}
+
+// markupDecorations maps the names of decoration tags to decorations.
+var markupDecorations = map[string]Decoration{
+	"bold":          DecorationBold,
+	"b":             DecorationBold,
+	"italic":        DecorationItalic,
+	"i":             DecorationItalic,
+	"em":            DecorationItalic,
+	"underlined":    DecorationUnderlined,
+	"u":             DecorationUnderlined,
+	"strikethrough": DecorationStrikethrough,
+	"st":            DecorationStrikethrough,
+	"obfuscated":    DecorationObfuscated,
+	"obf":           DecorationObfuscated,
+}
+
+// markupAliases maps alternative tag names to their canonical name, which
+// is used to match closing tags.
+var markupAliases = map[string]string{
+	"b":         "bold",
+	"i":         "italic",
+	"em":        "italic",
+	"u":         "underlined",
+	"st":        "strikethrough",
+	"obf":       "obfuscated",
+	"c":         "color",
+	"colour":    "color",
+	"insertion": "insert",
+	"br":        "newline",
+	"tr":        "lang",
+	"translate": "lang",
+}
+
+func canonicalTag(name string) string {
+	name = strings.ToLower(name)
+	if alias, found := markupAliases[name]; found {
+		return alias
+	}
+
+	return name
+}
+
+// open starts a new tag with the component as its style.
+func (p *markupParser) open(name string, component Component) *markupNode {
+	p.flush()
+	node := &markupNode{name: name, component: component}
+	p.stack = append(p.stack, node)
+	return node
+}
+
+// appendComponent appends a self-closing tag's component to the innermost
+// open tag.
+func (p *markupParser) appendComponent(component Component) {
+	p.flush()
+	top := p.top()
+	top.component.Extra = append(top.component.Extra, component)
+}
+
+func (p *markupParser) handleTag(start int, contents string) error {
+	if strings.HasPrefix(contents, "/") {
+		return p.closeTag(start, canonicalTag(strings.TrimSpace(contents[1:])))
+	}
+
+	arguments := splitTag(contents, start+1)
+	name := strings.ToLower(arguments[0].value)
+	arguments = arguments[1:]
+
+	if strings.HasPrefix(name, "!") {
+		decoration, found := markupDecorations[name[1:]]
+		if !found {
+			return p.errorAt(start, "unknown decoration %q", name[1:])
+		}
+
+		component := Component{}
+		component.SetDecoration(decoration, false)
+		p.open(string(decoration), component)
+		return nil
+	}
+
+	if decoration, found := markupDecorations[name]; found {
+		component := Component{}
+		component.SetDecoration(decoration, true)
+		p.open(string(decoration), component)
+		return nil
+	}
+
+	if color, err := ParseColor(name); err == nil && color != ColorReset {
+		p.open(string(color), Component{Color: color})
+		return nil
+	}
+
+	switch canonicalTag(name) {
+	case "color":
+		if len(arguments) != 1 {
+			return p.errorAt(start, "color tag requires a color")
+		}
+
+		color, err := ParseColor(arguments[0].value)
+		if err != nil {
+			return p.errorAt(arguments[0].offset, "invalid color %q",
+				arguments[0].value)
+		}
+
+		p.open("color", Component{Color: color})
+	case "reset":
+		p.closeTo(1)
+	case "click":
+		if len(arguments) < 2 {
+			return p.errorAt(start, "click tag requires an action and a value")
+		}
+
+		action := ClickAction(strings.ToLower(arguments[0].value))
+		switch action {
+		case ClickOpenURL, ClickRunCommand, ClickSuggestCommand,
+			ClickChangePage, ClickCopyToClipboard:
+		default:
+			return p.errorAt(arguments[0].offset, "unknown click action %q",
+				arguments[0].value)
+		}
+
+		p.open("click", Component{ClickEvent: &ClickEvent{
+			Action: action,
+			Value:  joinArguments(arguments[1:]),
+		}})
+	case "hover":
+		if len(arguments) < 2 {
+			return p.errorAt(start, "hover tag requires an action and a value")
+		}
+
+		if HoverAction(strings.ToLower(arguments[0].value)) != HoverShowText {
+			return p.errorAt(arguments[0].offset, "unsupported hover action %q",
+				arguments[0].value)
+		}
+
+		markup, positions := p.argumentMarkup(arguments[1:])
+		text, err := parseMarkup(p.full, markup, positions)
+		if err != nil {
+			return err
+		}
+
+		p.open("hover", Component{HoverEvent: &HoverEvent{
+			Action:   HoverShowText,
+			Contents: text,
+		}})
+	case "insert":
+		if len(arguments) < 1 {
+			return p.errorAt(start, "insert tag requires text")
+		}
+
+		p.open("insert", Component{Insertion: joinArguments(arguments)})
+	case "font":
+		if len(arguments) < 1 {
+			return p.errorAt(start, "font tag requires a font")
+		}
+
+		p.open("font", Component{Font: joinArguments(arguments)})
+	case "gradient":
+		colors := make([]Color, 0, len(arguments))
+		for _, argument := range arguments {
+			color, err := ParseColor(argument.value)
+			if err != nil || color == ColorReset {
+				return p.errorAt(argument.offset, "invalid gradient color %q",
+					argument.value)
+			}
+			colors = append(colors, color)
+		}
+
+		if len(colors) == 0 {
+			colors = []Color{ColorWhite, ColorBlack}
+		} else if len(colors) == 1 {
+			return p.errorAt(start, "gradient tag requires at least 2 colors")
+		}
+
+		p.open("gradient", Component{}).colors = colors
+	case "rainbow":
+		p.open("rainbow", Component{}).rainbow = true
+	case "newline":
+		p.appendComponent(Text("\n"))
+	case "key":
+		if len(arguments) != 1 {
+			return p.errorAt(start, "key tag requires a key")
+		}
+
+		p.appendComponent(Keybind(arguments[0].value))
+	case "lang":
+		if len(arguments) < 1 {
+			return p.errorAt(start, "lang tag requires a translation key")
+		}
+
+		with := make([]Component, 0, len(arguments)-1)
+		for _, argument := range arguments[1:] {
+			markup, positions := p.argumentMarkup([]markupArgument{argument})
+			component, err := parseMarkup(p.full, markup, positions)
+			if err != nil {
+				return err
+			}
+			with = append(with, component)
+		}
+
+		p.appendComponent(Translate(arguments[0].value, with...))
+	default:
+		return p.errorAt(start, "unknown tag %q", name)
+	}
+
+	return nil
+}
+
+// closeTag closes the most recently opened tag with the name, and any tags
+// opened after it.
+func (p *markupParser) closeTag(start int, name string) error {
+	if color, err := ParseColor(name); err == nil {
+		name = string(color)
+	}
+
+	if decoration, found := markupDecorations[strings.TrimPrefix(name, "!")]; found {
+		name = string(decoration)
+	}
+
+	for i := len(p.stack) - 1; i > 0; i-- {
+		node := p.stack[i]
+		if node.name == name || (name == "color" && isColorNode(node)) {
+			p.closeTo(i)
+			return nil
+		}
+	}
+
+	return p.errorAt(start, "closing tag </%s> does not match any open tag",
+		name)
+}
+
+// isColorNode returns whether the node was opened by a color tag, which
+// </color> can close.
+func isColorNode(node *markupNode) bool {
+	return node.component.Color != "" && node.colors == nil && !node.rainbow
+}
+
+// joinArguments joins arguments back together, for values that may contain
+// a : themselves such as URLs.
+func joinArguments(arguments []markupArgument) string {
+	values := make([]string, len(arguments))
+	for i, argument := range arguments {
+		values[i] = argument.value
+	}
+
+	return strings.Join(values, ":")
+}
+
+// countGradientRunes returns the number of characters of text that a
+// gradient applies to in the component.
+func countGradientRunes(component Component) int {
+	total := 0
+	if component.Translate == "" && component.Keybind == "" {
+		total += utf8.RuneCountInString(component.Text)
+	}
+
+	for _, child := range component.Extra {
+		total += countGradientRunes(child)
+	}
+
+	return total
+}
+
+// applyGradient colors each character of text in the component along the
+// gradient of the node. Text with its own color is skipped over.
+func applyGradient(component Component, node *markupNode, total int,
+	index *int) Component {
+	if component.Color != "" {
+		*index += countGradientRunes(component)
+		return component
+	}
+
+	if component.Text != "" && component.Translate == "" &&
+		component.Keybind == "" {
+		container := component
+		container.Text = ""
+		container.Extra = nil
+
+		for _, r := range component.Text {
+			position := 0.0
+			if total > 1 {
+				position = float64(*index) / float64(total-1)
+			}
+
+			var color Color
+			if node.rainbow {
+				color = rainbowColor(position)
+			} else {
+				color = gradientColor(position, node.colors)
+			}
+
+			container.Extra = append(container.Extra, Component{
+				Text:  string(r),
+				Color: color,
+			})
+			*index++
+		}
+
+		for _, child := range component.Extra {
+			container.Extra = append(container.Extra,
+				applyGradient(child, node, total, index))
+		}
+
+		return container
+	}
+
+	if component.Extra != nil {
+		extra := make([]Component, len(component.Extra))
+		for i, child := range component.Extra {
+			extra[i] = applyGradient(child, node, total, index)
+		}
+		component.Extra = extra
+	}
+
+	return component
+}
+
+// rainbowColor returns the color at the position (from 0 to 1) along a
+// rainbow, by rotating the hue.
+func rainbowColor(position float64) Color {
+	hue := position * 6
+	x := 1 - math.Abs(math.Mod(hue, 2)-1)
+
+	var r, g, b float64
+	switch int(hue) % 6 {
+	case 0:
+		r, g = 1, x
+	case 1:
+		r, g = x, 1
+	case 2:
+		g, b = 1, x
+	case 3:
+		g, b = x, 1
+	case 4:
+		r, b = x, 1
+	default:
+		r, b = 1, x
+	}
+
+	return RGB(uint8(r*255+0.5), uint8(g*255+0.5), uint8(b*255+0.5))
+}
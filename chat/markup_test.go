@@ -0,0 +1,155 @@
+package chat
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestParseMarkup(t *testing.T) {
+	tests := []struct {
+		markup string
+		json   string
+	}{
+		{"plain", `{"text":"plain"}`},
+		// Nested, unclosed and mismatched tags.
+		{"<red>Server <bold>closed</bold></red>", `{"text":"","color":"red",` +
+			`"extra":[{"text":"Server "},{"text":"","bold":true,"extra":` +
+			`[{"text":"closed"}]}]}`},
+		{"<red>a<bold>b", `{"text":"","color":"red","extra":[{"text":"a"},` +
+			`{"text":"","bold":true,"extra":[{"text":"b"}]}]}`},
+		{"<red>a<bold>b</red>c", `{"text":"","extra":[{"text":"","color":` +
+			`"red","extra":[{"text":"a"},{"text":"","bold":true,"extra":` +
+			`[{"text":"b"}]}]},{"text":"c"}]}`},
+		{"<red>a<reset>b", `{"text":"","extra":[{"text":"","color":"red",` +
+			`"extra":[{"text":"a"}]},{"text":"b"}]}`},
+		// Aliases close the tags they're aliases of.
+		{"<b>a</bold><i>b</em>", `{"text":"","extra":[{"text":"","bold":` +
+			`true,"extra":[{"text":"a"}]},{"text":"","italic":true,"extra":` +
+			`[{"text":"b"}]}]}`},
+		{"<c:red>a</color><#FF5555>b</#ff5555>", `{"text":"","extra":` +
+			`[{"text":"","color":"red","extra":[{"text":"a"}]},{"text":"",` +
+			`"color":"#FF5555","extra":[{"text":"b"}]}]}`},
+		{"<bold>a<!bold>b</!bold>c", `{"text":"","bold":true,"extra":` +
+			`[{"text":"a"},{"text":"","bold":false,"extra":[{"text":"b"}]},` +
+			`{"text":"c"}]}`},
+		// Escapes, which only apply to < and \.
+		{`\<red> \\ \n`, `{"text":"\u003cred\u003e \\ \\n"}`},
+		{`<click:open_url:'https://example.com/?a=1'>link</click>`,
+			`{"text":"","clickEvent":{"action":"open_url","value":` +
+				`"https://example.com/?a=1"},"extra":[{"text":"link"}]}`},
+		{`<insert:'it\'s'>x`, `{"text":"","insertion":"it's","extra":` +
+			`[{"text":"x"}]}`},
+		{"<hover:show_text:'<red>hi'>text", `{"text":"","hoverEvent":` +
+			`{"action":"show_text","contents":{"text":"","color":"red",` +
+			`"extra":[{"text":"hi"}]}},"extra":[{"text":"text"}]}`},
+		{"<lang:chat.type.text:'<red>a':b>", `{"translate":` +
+			`"chat.type.text","with":[{"text":"","color":"red","extra":` +
+			`[{"text":"a"}]},{"text":"b"}]}`},
+		{"a<br><key:key.jump>", `{"text":"","extra":[{"text":"a"},` +
+			`{"text":"\n"},{"keybind":"key.jump"}]}`},
+		// Gradients color each character, skipping over text with its own
+		// color.
+		{"<gradient:#000000:#ffffff>abc</gradient>", `{"text":"","extra":` +
+			`[{"text":"","extra":[{"text":"a","color":"#000000"},{"text":` +
+			`"b","color":"#808080"},{"text":"c","color":"#FFFFFF"}]}]}`},
+		{"<gradient:#000000:#ffffff>a<red>b</red>c", `{"text":"","extra":` +
+			`[{"text":"","extra":[{"text":"a","color":"#000000"}]},{"text":` +
+			`"","color":"red","extra":[{"text":"b"}]},{"text":"","extra":` +
+			`[{"text":"c","color":"#FFFFFF"}]}]}`},
+		{"<gradient>ab", `{"text":"","extra":[{"text":"","extra":[{"text":` +
+			`"a","color":"#FFFFFF"},{"text":"b","color":"#000000"}]}]}`},
+		{"<rainbow>abc</rainbow>", `{"text":"","extra":[{"text":"","extra":` +
+			`[{"text":"a","color":"#FF0000"},{"text":"b","color":"#00FFFF"},` +
+			`{"text":"c","color":"#FF0000"}]}]}`},
+	}
+
+	for _, test := range tests {
+		component, err := ParseMarkup(test.markup)
+		if err != nil {
+			t.Errorf("ParseMarkup(%q): %v", test.markup, err)
+			continue
+		}
+
+		data, err := json.Marshal(component)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(data) != test.json {
+			t.Errorf("ParseMarkup(%q) = %s, want %s", test.markup, data,
+				test.json)
+		}
+	}
+}
+
+func TestParseMarkupErrors(t *testing.T) {
+	tests := []struct {
+		markup string
+		offset int
+		line   int
+		column int
+	}{
+		{"a</red>", 1, 1, 2},
+		{"<red", 0, 1, 1},
+		{"<click:'open_url>", 0, 1, 1},
+		{"<color:nope>", 7, 1, 8},
+		{"<gradient:red>", 0, 1, 1},
+		{"<gradient:red:nope>", 14, 1, 15},
+		{"<click:open_url>", 0, 1, 1},
+		{"<hover:show_entity:x>", 7, 1, 8},
+		{"<!nope>", 0, 1, 1},
+		// Columns are counted in characters.
+		{"line one\n  <unknown>", 11, 2, 3},
+		{"héllo\nwörld <bad>", 14, 2, 7},
+		// Errors in arguments parsed as markup are at their position in the
+		// original markup, even after quotes and escapes are removed.
+		{"a\n<hover:show_text:'x\n<nope>'>", 22, 3, 1},
+		{`<hover:show_text:'\'\'<nope>'>`, 22, 1, 23},
+		{`<lang:key:"\"é<x>":b>`, 15, 1, 15},
+		{"<hover:show_text:a:b<nope>>", 20, 1, 21},
+	}
+
+	for _, test := range tests {
+		_, err := ParseMarkup(test.markup)
+		var markupErr *MarkupError
+		if !errors.As(err, &markupErr) {
+			t.Errorf("ParseMarkup(%q): error = %v, want a *MarkupError",
+				test.markup, err)
+			continue
+		}
+
+		if markupErr.Offset != test.offset || markupErr.Line != test.line ||
+			markupErr.Column != test.column {
+			t.Errorf("ParseMarkup(%q): error at offset %d, line %d, column "+
+				"%d, want offset %d, line %d, column %d", test.markup,
+				markupErr.Offset, markupErr.Line, markupErr.Column,
+				test.offset, test.line, test.column)
+		}
+	}
+}
+
+func FuzzParseMarkup(f *testing.F) {
+	for _, seed := range []string{
+		"<red>Server <bold>closed</bold></red>",
+		"<gradient:red:blue>text</gradient>",
+		"<rainbow>rainbow <b>bold</rainbow>",
+		"<hover:show_text:'<red>hi\\'\nthere'>hover</hover>",
+		"<lang:key:'<blue>a':b>",
+		"<click:open_url:'https://example.com'>link</click>",
+		"\\<escaped \\\\ <br><key:key.jump>",
+		"<red\n>",
+		"é\n<unknown>",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, markup string) {
+		_, err := ParseMarkup(markup)
+		var markupErr *MarkupError
+		if err != nil && !errors.As(err, &markupErr) {
+			t.Errorf("ParseMarkup(%q): error %v isn't a *MarkupError", markup,
+				err)
+		}
+	})
+}
@@ -0,0 +1,687 @@
+package chat
+
+import (
+	"errors"
+	"strings"
+)
+
+// QRLevel is the error correction level of a QR code. Higher levels can be
+// scanned with more of the code damaged or obscured, but need more modules
+// to hold the same data.
+type QRLevel int
+
+// The error correction levels of QR codes.
+const (
+	// QRLow recovers about 7% of the code.
+	QRLow QRLevel = iota
+	// QRMedium recovers about 15% of the code.
+	QRMedium
+	// QRQuartile recovers about 25% of the code.
+	QRQuartile
+	// QRHigh recovers about 30% of the code.
+	QRHigh
+)
+
+// ErrQRTooLong is returned when data is too long to fit in a QR code at the
+// requested error correction level.
+var ErrQRTooLong = errors.New("chat: data too long for QR code")
+
+// QRDarkColor and QRLightColor are the colors of the dark and light modules
+// of QR codes drawn by QRCode.Lines.
+const (
+	QRDarkColor  = ColorBlack
+	QRLightColor = ColorWhite
+)
+
+// qrFormatBits are the bits that encode each error correction level in the
+// format information of a QR code.
+var qrFormatBits = [...]int{QRLow: 1, QRMedium: 0, QRQuartile: 3, QRHigh: 2}
+
+// qrECCCodewords is the number of error correction codewords in each block,
+// indexed by error correction level and version.
+var qrECCCodewords = [4][41]int{
+	{-1, 7, 10, 15, 20, 26, 18, 20, 24, 30, 18, 20, 24, 26, 30, 22, 24, 28, 30,
+		28, 28, 28, 28, 30, 30, 26, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30,
+		30, 30, 30, 30},
+	{-1, 10, 16, 26, 18, 24, 16, 18, 22, 22, 26, 30, 22, 22, 24, 24, 28, 28, 26,
+		26, 26, 26, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28,
+		28, 28, 28, 28},
+	{-1, 13, 22, 18, 26, 18, 24, 18, 22, 20, 24, 28, 26, 24, 20, 30, 24, 28, 28,
+		26, 30, 28, 30, 30, 30, 30, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30,
+		30, 30, 30, 30},
+	{-1, 17, 28, 22, 16, 22, 28, 26, 26, 24, 28, 24, 28, 22, 24, 24, 30, 28, 28,
+		26, 28, 30, 24, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30,
+		30, 30, 30, 30},
+}
+
+// qrBlocks is the number of error correction blocks, indexed by error
+// correction level and version.
+var qrBlocks = [4][41]int{
+	{-1, 1, 1, 1, 1, 1, 2, 2, 2, 2, 4, 4, 4, 4, 4, 6, 6, 6, 6, 7, 8, 8, 9, 9, 10,
+		12, 12, 12, 13, 14, 15, 16, 17, 18, 19, 19, 20, 21, 22, 24, 25},
+	{-1, 1, 1, 1, 2, 2, 4, 4, 4, 5, 5, 5, 8, 9, 9, 10, 10, 11, 13, 14, 16, 17,
+		17, 18, 20, 21, 23, 25, 26, 28, 29, 31, 33, 35, 37, 38, 40, 43, 45, 47,
+		49},
+	{-1, 1, 1, 2, 2, 4, 4, 6, 6, 8, 8, 8, 10, 12, 16, 12, 17, 16, 18, 21, 20, 23,
+		23, 25, 27, 29, 34, 34, 35, 38, 40, 43, 45, 48, 51, 53, 56, 59, 62, 65,
+		68},
+	{-1, 1, 1, 2, 4, 4, 4, 5, 6, 8, 8, 11, 11, 16, 16, 18, 16, 19, 21, 25, 25, 25,
+		34, 30, 32, 35, 37, 40, 42, 45, 48, 51, 54, 57, 60, 63, 66, 70, 74, 77,
+		81},
+}
+
+// QRCode is a QR code, made up of a square grid of dark and light modules.
+type QRCode struct {
+	// Version is the version of the QR code, from 1 to 40, which determines
+	// its size.
+	Version int
+	// Level is the error correction level of the QR code.
+	Level QRLevel
+
+	size     int
+	mask     int
+	modules  [][]bool
+	function [][]bool
+}
+
+// NewQRCode encodes the data as a QR code at the error correction level,
+// using the smallest version that it fits in.
+func NewQRCode(data string, level QRLevel) (*QRCode, error) {
+	if level < QRLow || level > QRHigh {
+		return nil, errors.New("chat: invalid QR code level")
+	}
+
+	for version := 1; version <= 40; version++ {
+		countBits := 8
+		if version >= 10 {
+			countBits = 16
+		}
+
+		capacity := qrDataCodewords(version, level) * 8
+		if 4+countBits+len(data)*8 > capacity {
+			continue
+		}
+
+		var bits qrBits
+		bits.append(0x4, 4)
+		bits.append(len(data), countBits)
+		for i := 0; i < len(data); i++ {
+			bits.append(int(data[i]), 8)
+		}
+
+		terminator := capacity - len(bits)
+		if terminator > 4 {
+			terminator = 4
+		}
+		bits.append(0, terminator)
+		bits.append(0, (8-len(bits)%8)%8)
+		for pad := 0xEC; len(bits) < capacity; pad ^= 0xEC ^ 0x11 {
+			bits.append(pad, 8)
+		}
+
+		code := &QRCode{Version: version, Level: level}
+		code.draw(bits.bytes())
+		return code, nil
+	}
+
+	return nil, ErrQRTooLong
+}
+
+// Size returns the width and height of the QR code in modules, without a
+// quiet zone.
+func (q *QRCode) Size() int {
+	return q.size
+}
+
+// Module returns whether the module at the coordinates is dark, where (0, 0)
+// is the top left. Coordinates outside of the code are light.
+func (q *QRCode) Module(x, y int) bool {
+	if x < 0 || y < 0 || x >= q.size || y >= q.size {
+		return false
+	}
+
+	return q.modules[y][x]
+}
+
+// Lines draws the QR code as legacy formatted lines, with a border of light
+// modules that is quietZone modules wide. Scanners need a quiet zone to find
+// the code, so it shouldn't be less than 2 unless the code is displayed on a
+// light background.
+//
+// Each line is two rows of modules, so that the modules are close to square.
+// Text only has one color, so where a dark and a light module share a
+// character, the light module is drawn as a half block and the dark module
+// is left for the background to show through. Codes should be displayed on a
+// dark background, such as on the disconnect screen or server list menu.
+func (q *QRCode) Lines(quietZone int) []string {
+	var lines []string
+	for y := -quietZone; y < q.size+quietZone; y += 2 {
+		var line strings.Builder
+		var current Color
+		for x := -quietZone; x < q.size+quietZone; x++ {
+			top, bottom := q.Module(x, y), q.Module(x, y+1)
+
+			color, glyph := QRLightColor, FullBlock
+			switch {
+			case top && bottom:
+				color = QRDarkColor
+			case top:
+				glyph = LowerBlock
+			case bottom:
+				glyph = UpperBlock
+			}
+
+			if color != current {
+				line.WriteString(legacyColorCode(color))
+				current = color
+			}
+
+			line.WriteRune(glyph)
+		}
+
+		lines = append(lines, line.String())
+	}
+
+	return lines
+}
+
+// String draws the QR code as a legacy formatted message with a quiet zone
+// 2 modules wide. See Lines.
+func (q *QRCode) String() string {
+	return strings.Join(q.Lines(2), "\n")
+}
+
+// QR encodes the data as a QR code at the medium error correction level,
+// and draws it as a legacy formatted message that can be shown on the
+// disconnect screen, such as by returning it from a handler. Every two rows
+// of modules are drawn as a line of text, so the data should be kept short,
+// such as a short link, for the code to fit on the screen at large GUI
+// scales.
+func QR(data string) (string, error) {
+	code, err := NewQRCode(data, QRMedium)
+	if err != nil {
+		return "", err
+	}
+
+	return code.String(), nil
+}
+
+// qrBits is a sequence of bits, most significant first.
+type qrBits []bool
+
+// append appends the lowest n bits of the value.
+func (b *qrBits) append(value int, n int) {
+	for i := n - 1; i >= 0; i-- {
+		*b = append(*b, value>>uint(i)&1 != 0)
+	}
+}
+
+// bytes packs the bits into bytes. The length of the sequence must be a
+// multiple of 8.
+func (b qrBits) bytes() []byte {
+	result := make([]byte, len(b)/8)
+	for i, bit := range b {
+		if bit {
+			result[i/8] |= 0x80 >> uint(i%8)
+		}
+	}
+
+	return result
+}
+
+// qrRawModules returns the number of modules of a version that are
+// available for data and error correction codewords, which includes the
+// remainder bits.
+func qrRawModules(version int) int {
+	result := (16*version+128)*version + 64
+	if version >= 2 {
+		alignments := version/7 + 2
+		result -= (25*alignments-10)*alignments - 55
+		if version >= 7 {
+			result -= 36
+		}
+	}
+
+	return result
+}
+
+// qrDataCodewords returns the number of data codewords a version holds at
+// the error correction level.
+func qrDataCodewords(version int, level QRLevel) int {
+	return qrRawModules(version)/8 -
+		qrECCCodewords[level][version]*qrBlocks[level][version]
+}
+
+// qrAlignmentPositions returns the positions of the rows and columns of the
+// alignment patterns of a version.
+func qrAlignmentPositions(version int) []int {
+	if version == 1 {
+		return nil
+	}
+
+	count := version/7 + 2
+	step := (version*8 + count*3 + 5) / (count*4 - 4) * 2
+	positions := make([]int, count)
+	positions[0] = 6
+	for i, position := count-1, version*4+10; i >= 1; i, position =
+		i-1, position-step {
+		positions[i] = position
+	}
+
+	return positions
+}
+
+// draw lays out the function patterns and the data codewords with error
+// correction, using the mask with the lowest penalty.
+func (q *QRCode) draw(data []byte) {
+	q.size = q.Version*4 + 17
+	q.modules = make([][]bool, q.size)
+	q.function = make([][]bool, q.size)
+	for i := range q.modules {
+		q.modules[i] = make([]bool, q.size)
+		q.function[i] = make([]bool, q.size)
+	}
+
+	q.drawFunctionPatterns()
+	q.drawCodewords(q.addErrorCorrection(data))
+
+	best, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		q.applyMask(mask)
+		q.drawFormatBits(mask)
+		if penalty := q.penalty(); bestPenalty < 0 || penalty < bestPenalty {
+			best, bestPenalty = mask, penalty
+		}
+		q.applyMask(mask)
+	}
+
+	q.mask = best
+	q.applyMask(best)
+	q.drawFormatBits(best)
+}
+
+// set sets a module that is part of a function pattern.
+func (q *QRCode) set(x, y int, dark bool) {
+	q.modules[y][x] = dark
+	q.function[y][x] = true
+}
+
+func (q *QRCode) drawFunctionPatterns() {
+	for i := 0; i < q.size; i++ {
+		q.set(6, i, i%2 == 0)
+		q.set(i, 6, i%2 == 0)
+	}
+
+	q.drawFinderPattern(3, 3)
+	q.drawFinderPattern(q.size-4, 3)
+	q.drawFinderPattern(3, q.size-4)
+
+	positions := qrAlignmentPositions(q.Version)
+	last := len(positions) - 1
+	for i, x := range positions {
+		for j, y := range positions {
+			// Alignment patterns are skipped where they would overlap the
+			// finder patterns.
+			if (i == 0 && j == 0) || (i == 0 && j == last) ||
+				(i == last && j == 0) {
+				continue
+			}
+
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					q.set(x+dx, y+dy, qrMax(absInt(dx), absInt(dy)) != 1)
+				}
+			}
+		}
+	}
+
+	// Reserve the format bits, which are drawn once the mask is chosen.
+	q.drawFormatBits(0)
+	q.drawVersionBits()
+}
+
+// drawFinderPattern draws a finder pattern and its separator centered on
+// the coordinates.
+func (q *QRCode) drawFinderPattern(x, y int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			if x+dx < 0 || x+dx >= q.size || y+dy < 0 || y+dy >= q.size {
+				continue
+			}
+
+			distance := qrMax(absInt(dx), absInt(dy))
+			q.set(x+dx, y+dy, distance != 2 && distance != 4)
+		}
+	}
+}
+
+// drawFormatBits draws both copies of the format information for the error
+// correction level and mask.
+func (q *QRCode) drawFormatBits(mask int) {
+	data := qrFormatBits[q.Level]<<3 | mask
+	remainder := data
+	for i := 0; i < 10; i++ {
+		remainder = remainder<<1 ^ (remainder>>9)*0x537
+	}
+	bits := (data<<10 | remainder) ^ 0x5412
+
+	bit := func(i int) bool {
+		return bits>>uint(i)&1 != 0
+	}
+
+	for i := 0; i <= 5; i++ {
+		q.set(8, i, bit(i))
+	}
+	q.set(8, 7, bit(6))
+	q.set(8, 8, bit(7))
+	q.set(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		q.set(14-i, 8, bit(i))
+	}
+
+	for i := 0; i < 8; i++ {
+		q.set(q.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		q.set(8, q.size-15+i, bit(i))
+	}
+	q.set(8, q.size-8, true)
+}
+
+// drawVersionBits draws both copies of the version information, which is
+// only present from version 7.
+func (q *QRCode) drawVersionBits() {
+	if q.Version < 7 {
+		return
+	}
+
+	remainder := q.Version
+	for i := 0; i < 12; i++ {
+		remainder = remainder<<1 ^ (remainder>>11)*0x1F25
+	}
+	bits := q.Version<<12 | remainder
+
+	for i := 0; i < 18; i++ {
+		dark := bits>>uint(i)&1 != 0
+		a, b := q.size-11+i%3, i/3
+		q.set(a, b, dark)
+		q.set(b, a, dark)
+	}
+}
+
+// addErrorCorrection splits the data into blocks, appends the Reed-Solomon
+// error correction codewords to each block, and interleaves the blocks.
+func (q *QRCode) addErrorCorrection(data []byte) []byte {
+	blockCount := qrBlocks[q.Level][q.Version]
+	eccLength := qrECCCodewords[q.Level][q.Version]
+	rawCodewords := qrRawModules(q.Version) / 8
+	shortBlocks := blockCount - rawCodewords%blockCount
+	shortLength := rawCodewords / blockCount
+
+	divisor := qrDivisor(eccLength)
+	blocks := make([][]byte, blockCount)
+	offset := 0
+	for i := range blocks {
+		dataLength := shortLength - eccLength
+		if i >= shortBlocks {
+			dataLength++
+		}
+
+		block := append([]byte(nil), data[offset:offset+dataLength]...)
+		offset += dataLength
+		ecc := qrRemainder(block, divisor)
+		if i < shortBlocks {
+			// Short blocks are padded so that the codewords of every block
+			// line up when interleaved.
+			block = append(block, 0)
+		}
+		blocks[i] = append(block, ecc...)
+	}
+
+	result := make([]byte, 0, rawCodewords)
+	for i := 0; i <= shortLength; i++ {
+		for j, block := range blocks {
+			if i != shortLength-eccLength || j >= shortBlocks {
+				result = append(result, block[i])
+			}
+		}
+	}
+
+	return result
+}
+
+// qrDivisor returns the generator polynomial of the given degree for
+// Reed-Solomon error correction, without its leading term.
+func qrDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = qrMultiply(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = qrMultiply(root, 0x02)
+	}
+
+	return result
+}
+
+// qrRemainder returns the remainder of the data divided by the generator
+// polynomial, which are the error correction codewords.
+func qrRemainder(data []byte, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i := range result {
+			result[i] ^= qrMultiply(divisor[i], factor)
+		}
+	}
+
+	return result
+}
+
+// qrMultiply multiplies two elements of the Galois field GF(2^8) with the
+// polynomial used by QR codes.
+func qrMultiply(x, y byte) byte {
+	result := 0
+	for i := 7; i >= 0; i-- {
+		result = result<<1 ^ (result>>7)*0x11D
+		result ^= int(y>>uint(i)&1) * int(x)
+	}
+
+	return byte(result)
+}
+
+// drawCodewords places the codewords in the modules that aren't part of
+// function patterns, in the zigzag order of QR codes.
+func (q *QRCode) drawCodewords(codewords []byte) {
+	i := 0
+	for right := q.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			// Skip the vertical timing pattern.
+			right = 5
+		}
+
+		for vertical := 0; vertical < q.size; vertical++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				upward := (right+1)&2 == 0
+				y := vertical
+				if upward {
+					y = q.size - 1 - vertical
+				}
+
+				if q.function[y][x] {
+					continue
+				}
+
+				if i < len(codewords)*8 {
+					q.modules[y][x] = codewords[i/8]>>uint(7-i%8)&1 != 0
+					i++
+				}
+			}
+		}
+	}
+}
+
+// applyMask inverts the data modules selected by the mask pattern. Applying
+// the same mask twice undoes it.
+func (q *QRCode) applyMask(mask int) {
+	for y := 0; y < q.size; y++ {
+		for x := 0; x < q.size; x++ {
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+
+			if invert && !q.function[y][x] {
+				q.modules[y][x] = !q.modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty scores the modules by how hard they would be to scan, as defined
+// by the QR code specification. Lower is better.
+func (q *QRCode) penalty() int {
+	result := 0
+
+	for vertical := 0; vertical < 2; vertical++ {
+		for a := 0; a < q.size; a++ {
+			module := func(b int) bool {
+				if vertical == 1 {
+					return q.modules[b][a]
+				}
+				return q.modules[a][b]
+			}
+
+			run := 0
+			for b := 0; b < q.size; b++ {
+				if b > 0 && module(b) == module(b-1) {
+					run++
+				} else {
+					run = 1
+				}
+
+				if run == 5 {
+					result += 3
+				} else if run > 5 {
+					result++
+				}
+			}
+
+			// Patterns that look like finder patterns are found from the
+			// lengths of the last 7 runs of modules, which alternate between
+			// light and dark. The code is surrounded by the quiet zone, which
+			// is counted as a light run as wide as the code.
+			var runs [7]int
+			push := func(length int, dark bool) {
+				copy(runs[1:], runs[:6])
+				runs[0] = length
+				if !dark {
+					result += qrFinderLike(runs) * 40
+				}
+			}
+
+			dark, length := false, q.size
+			for b := 0; b < q.size; b++ {
+				if module(b) == dark {
+					length++
+					continue
+				}
+
+				push(length, dark)
+				dark, length = !dark, 1
+			}
+
+			if dark {
+				push(length, dark)
+				length = 0
+			}
+			push(length+q.size, false)
+		}
+	}
+
+	dark := 0
+	for y := 0; y < q.size; y++ {
+		for x := 0; x < q.size; x++ {
+			if q.modules[y][x] {
+				dark++
+			}
+
+			if x > 0 && y > 0 && q.modules[y][x] == q.modules[y][x-1] &&
+				q.modules[y][x] == q.modules[y-1][x] &&
+				q.modules[y][x] == q.modules[y-1][x-1] {
+				result += 3
+			}
+		}
+	}
+
+	// 10 points for every full 5% that the proportion of dark modules is
+	// away from 50%.
+	total := q.size * q.size
+	deviation := absInt(dark*20 - total*10)
+	result += ((deviation+total-1)/total - 1) * 10
+
+	return result
+}
+
+// qrFinderLike returns the number of patterns that look like finder patterns
+// in the most recent runs of modules, most recent first, where the first
+// is light. These are dark-light runs of 1:1:3:1:1 at any scale, with a
+// light run at least 4 times as wide on either side, so a pattern with both
+// is counted twice.
+func qrFinderLike(runs [7]int) int {
+	n := runs[1]
+	if n == 0 || runs[2] != n || runs[3] != n*3 || runs[4] != n ||
+		runs[5] != n {
+		return 0
+	}
+
+	count := 0
+	if runs[0] >= n*4 && runs[6] >= n {
+		count++
+	}
+	if runs[6] >= n*4 && runs[0] >= n {
+		count++
+	}
+
+	return count
+}
+
+func absInt(x int) int {
+	if x < 0 {
+		return -x
+	}
+
+	return x
+}
+
+func qrMax(a, b int) int {
+	if a > b {
+		return a
+	}
+
+	return b
+}
@@ -0,0 +1,233 @@
+package chat
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// qrRows returns the modules of the QR code as rows of # for dark modules
+// and . for light modules, as in the files in testdata/qr.
+func qrRows(q *QRCode) []string {
+	var rows []string
+	for y := 0; y < q.Size(); y++ {
+		var row strings.Builder
+		for x := 0; x < q.Size(); x++ {
+			if q.Module(x, y) {
+				row.WriteByte('#')
+			} else {
+				row.WriteByte('.')
+			}
+		}
+		rows = append(rows, row.String())
+	}
+
+	return rows
+}
+
+// readQRRows reads a file from testdata/qr, and returns its groups of rows,
+// which are separated by blank lines.
+func readQRRows(t *testing.T, name string) [][]string {
+	data, err := os.ReadFile(filepath.Join("testdata", "qr", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var groups [][]string
+	for _, group := range strings.Split(strings.TrimSpace(string(data)),
+		"\n\n") {
+		groups = append(groups, strings.Split(group, "\n"))
+	}
+
+	return groups
+}
+
+func compareQRRows(t *testing.T, name string, rows, expected []string) {
+	if len(rows) != len(expected) {
+		t.Errorf("%s: %d rows, want %d", name, len(rows), len(expected))
+		return
+	}
+
+	for y := range rows {
+		if rows[y] != expected[y] {
+			t.Errorf("%s: row %d = %s, want %s", name, y, rows[y], expected[y])
+		}
+	}
+}
+
+// The expected modules in testdata/qr were generated by Kazuhiko Arase's
+// QR code library, with the mask chosen by the penalty score of Project
+// Nayuki's QR code generator.
+func TestQRCodeVectors(t *testing.T) {
+	tests := []struct {
+		data    string
+		level   QRLevel
+		version int
+		mask    int
+		file    string
+	}{
+		{"beacon", QRLow, 1, 6, "1-L.txt"},
+		{"beacon", QRHigh, 1, 3, "1-H.txt"},
+		{"https://example.com/join", QRMedium, 2, 4, "2-M.txt"},
+		{"https://example.com/?" + strings.Repeat("a", 43), QRQuartile, 6, 2,
+			"6-Q.txt"},
+		// Versions 7 and above have version information, and versions 10
+		// and above have a longer character count.
+		{strings.Repeat("Join play.example.com to continue, ", 3), QRHigh,
+			10, 5, "10-H.txt"},
+	}
+
+	for _, test := range tests {
+		code, err := NewQRCode(test.data, test.level)
+		if err != nil {
+			t.Errorf("%s: %v", test.file, err)
+			continue
+		}
+
+		if code.Version != test.version || code.mask != test.mask {
+			t.Errorf("%s: version %d, mask %d, want version %d, mask %d",
+				test.file, code.Version, code.mask, test.version, test.mask)
+		}
+
+		compareQRRows(t, test.file, qrRows(code),
+			readQRRows(t, test.file)[0])
+	}
+}
+
+func TestQRCodeMasks(t *testing.T) {
+	code, err := NewQRCode("beacon", QRLow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := readQRRows(t, "masks.txt")
+	code.applyMask(code.mask)
+	for mask := 0; mask < 8; mask++ {
+		code.applyMask(mask)
+		code.drawFormatBits(mask)
+		compareQRRows(t, "mask "+strconv.Itoa(mask), qrRows(code),
+			expected[mask])
+		code.applyMask(mask)
+	}
+}
+
+func TestQRCodeVersions(t *testing.T) {
+	tests := []struct {
+		length  int
+		level   QRLevel
+		version int
+	}{
+		{17, QRLow, 1},
+		{18, QRLow, 2},
+		{14, QRMedium, 1},
+		{15, QRMedium, 2},
+		{11, QRQuartile, 1},
+		{12, QRQuartile, 2},
+		{7, QRHigh, 1},
+		{8, QRHigh, 2},
+		// The character count is 16 bits from version 10.
+		{230, QRLow, 9},
+		{231, QRLow, 10},
+		{220, QRHigh, 15},
+		{2953, QRLow, 40},
+		{1273, QRHigh, 40},
+	}
+
+	for _, test := range tests {
+		code, err := NewQRCode(strings.Repeat("a", test.length), test.level)
+		if err != nil {
+			t.Errorf("%d bytes at level %d: %v", test.length, test.level, err)
+			continue
+		}
+
+		if code.Version != test.version {
+			t.Errorf("%d bytes at level %d: version %d, want %d", test.length,
+				test.level, code.Version, test.version)
+		}
+
+		if size := code.Size(); size != test.version*4+17 {
+			t.Errorf("version %d: size %d", test.version, size)
+		}
+	}
+
+	for _, level := range []QRLevel{QRLow, QRHigh} {
+		length := 2954
+		if level == QRHigh {
+			length = 1274
+		}
+
+		if _, err := NewQRCode(strings.Repeat("a", length),
+			level); err != ErrQRTooLong {
+			t.Errorf("%d bytes at level %d: error = %v, want ErrQRTooLong",
+				length, level, err)
+		}
+	}
+
+	if _, err := NewQRCode("a", QRHigh+1); err == nil {
+		t.Error("invalid level: expected an error")
+	}
+}
+
+func TestQRErrorCorrection(t *testing.T) {
+	// The data codewords of "HELLO WORLD" as a 1-M code, and their error
+	// correction codewords.
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236,
+		17, 236, 17}
+	expected := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+
+	if ecc := qrRemainder(data, qrDivisor(10)); !bytes.Equal(ecc, expected) {
+		t.Errorf("error correction = %v, want %v", ecc, expected)
+	}
+}
+
+func TestQRCodeLines(t *testing.T) {
+	code, err := NewQRCode("beacon", QRLow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const quietZone = 2
+	size := code.Size() + quietZone*2
+	lines := code.Lines(quietZone)
+	if len(lines) != (size+1)/2 {
+		t.Fatalf("%d lines, want %d", len(lines), (size+1)/2)
+	}
+
+	if light := "§f" + strings.Repeat("█", size); lines[0] != light {
+		t.Errorf("line 0 = %q, want %q", lines[0], light)
+	}
+
+	// Decode the modules from the lines, where half blocks are light
+	// modules next to a dark module.
+	for i, line := range lines {
+		if width := Width(line); width != size*GlyphWidth(FullBlock, false) {
+			t.Errorf("line %d: width %d", i, width)
+		}
+
+		x := -quietZone
+		for _, styled := range legacyRunes(line) {
+			color := styled.style.color
+			top, bottom := color == QRDarkColor, color == QRDarkColor
+			switch styled.r {
+			case UpperBlock:
+				top, bottom = false, true
+			case LowerBlock:
+				top, bottom = true, false
+			}
+
+			y := i*2 - quietZone
+			if top != code.Module(x, y) || bottom != code.Module(x, y+1) {
+				t.Errorf("line %d: (%d, %d) = %c in %s", i, x, y, styled.r,
+					color)
+			}
+			x++
+		}
+
+		if x != size-quietZone {
+			t.Errorf("line %d: %d modules, want %d", i, x+quietZone, size)
+		}
+	}
+}
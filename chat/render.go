@@ -0,0 +1,272 @@
+package chat
+
+import (
+	"html"
+	"strconv"
+	"strings"
+)
+
+// ANSIMode is the kind of color supported by a terminal, used by ANSI.
+type ANSIMode int
+
+// The kinds of color supported by terminals.
+const (
+	// ANSITrueColor uses 24-bit RGB colors.
+	ANSITrueColor ANSIMode = iota
+	// ANSI256 uses the 256 color palette of xterm.
+	ANSI256
+	// ANSI16 uses the 16 standard colors, which are mapped from the
+	// named colors.
+	ANSI16
+)
+
+const ansiReset = "\x1b[0m"
+
+// ansi16Colors maps the named colors to the SGR codes of the 16 standard
+// terminal colors.
+var ansi16Colors = map[Color]int{
+	ColorBlack:       30,
+	ColorDarkBlue:    34,
+	ColorDarkGreen:   32,
+	ColorDarkAqua:    36,
+	ColorDarkRed:     31,
+	ColorDarkPurple:  35,
+	ColorGold:        33,
+	ColorGray:        37,
+	ColorDarkGray:    90,
+	ColorBlue:        94,
+	ColorGreen:       92,
+	ColorAqua:        96,
+	ColorRed:         91,
+	ColorLightPurple: 95,
+	ColorYellow:      93,
+	ColorWhite:       97,
+}
+
+// ansiDecorations maps decorations to their SGR codes. Obfuscated text is
+// rendered as blinking.
+var ansiDecorations = map[Decoration]int{
+	DecorationBold:          1,
+	DecorationItalic:        3,
+	DecorationUnderlined:    4,
+	DecorationObfuscated:    5,
+	DecorationStrikethrough: 9,
+}
+
+// HTMLObfuscatedClass is the CSS class given to obfuscated text by HTML.
+// See HTMLStyle.
+const HTMLObfuscatedClass = "mc-obfuscated"
+
+// HTMLStyle is a CSS style sheet that animates obfuscated text rendered by
+// HTML, to be included on pages that display it.
+const HTMLStyle = `.` + HTMLObfuscatedClass + ` {
+	animation: ` + HTMLObfuscatedClass + ` 0.2s steps(1) infinite;
+}
+
+@keyframes ` + HTMLObfuscatedClass + ` {
+	0% { filter: blur(0); opacity: 1; }
+	50% { filter: blur(2px); opacity: 0.6; }
+}
+`
+
+// styledRuns groups the characters into runs of the same style.
+func styledRuns(runes []styledRune) ([]string, []style) {
+	var texts []string
+	var styles []style
+	var text strings.Builder
+
+	for i, r := range runes {
+		if i > 0 && !r.style.equals(runes[i-1].style) {
+			texts = append(texts, text.String())
+			styles = append(styles, runes[i-1].style)
+			text.Reset()
+		}
+
+		text.WriteRune(r.r)
+	}
+
+	if text.Len() > 0 {
+		texts = append(texts, text.String())
+		styles = append(styles, runes[len(runes)-1].style)
+	}
+
+	return texts, styles
+}
+
+// Plain returns the legacy formatted message with all formatting codes
+// removed.
+func Plain(message string) string {
+	var builder strings.Builder
+	for _, r := range legacyRunes(message) {
+		builder.WriteRune(r.r)
+	}
+
+	return builder.String()
+}
+
+// ANSI renders the legacy formatted message with ANSI escape codes, for
+// display in a terminal.
+func ANSI(message string, mode ANSIMode) string {
+	var builder strings.Builder
+	texts, styles := styledRuns(legacyRunes(message))
+	styled := false
+
+	for i, text := range texts {
+		codes := ansiCodes(styles[i], mode)
+		if len(codes) > 0 {
+			builder.WriteString("\x1b[0;" + strings.Join(codes, ";") + "m")
+			styled = true
+		} else if styled {
+			builder.WriteString(ansiReset)
+			styled = false
+		}
+
+		builder.WriteString(text)
+	}
+
+	if styled {
+		builder.WriteString(ansiReset)
+	}
+
+	return builder.String()
+}
+
+// ANSI renders the component with ANSI escape codes, for display in
+// a terminal.
+func (c Component) ANSI(mode ANSIMode) string {
+	return ANSI(c.ToLegacy(), mode)
+}
+
+// ansiCodes returns the SGR codes for the style.
+func ansiCodes(s style, mode ANSIMode) []string {
+	var codes []string
+
+	if r, g, b, ok := s.color.RGB(); ok {
+		switch mode {
+		case ANSITrueColor:
+			codes = append(codes, "38;2;"+strconv.Itoa(int(r))+";"+
+				strconv.Itoa(int(g))+";"+strconv.Itoa(int(b)))
+		case ANSI256:
+			codes = append(codes, "38;5;"+strconv.Itoa(ansi256Color(r, g, b)))
+		default:
+			codes = append(codes, strconv.Itoa(ansi16Colors[s.color.Nearest()]))
+		}
+	}
+
+	for _, decoration := range Decorations {
+		if s.decorations[decoration] {
+			codes = append(codes, strconv.Itoa(ansiDecorations[decoration]))
+		}
+	}
+
+	return codes
+}
+
+// ansi256Color returns the closest color in the 6x6x6 color cube or the
+// grayscale ramp of the xterm 256 color palette.
+func ansi256Color(r, g, b uint8) int {
+	cube := func(value uint8) int {
+		if value < 48 {
+			return 0
+		} else if value < 115 {
+			return 1
+		}
+		return (int(value) - 35) / 40
+	}
+
+	levels := []int{0, 95, 135, 175, 215, 255}
+	cr, cg, cb := cube(r), cube(g), cube(b)
+	cubeIndex := 16 + 36*cr + 6*cg + cb
+
+	average := (int(r) + int(g) + int(b)) / 3
+	grayIndex := 23
+	if average < 238 {
+		grayIndex = (average - 3) / 10
+		if grayIndex < 0 {
+			grayIndex = 0
+		}
+	}
+	gray := 8 + 10*grayIndex
+
+	distance := func(dr, dg, db int) int {
+		return dr*dr + dg*dg + db*db
+	}
+
+	cubeDistance := distance(levels[cr]-int(r), levels[cg]-int(g),
+		levels[cb]-int(b))
+	grayDistance := distance(gray-int(r), gray-int(g), gray-int(b))
+
+	if grayDistance < cubeDistance {
+		return 232 + grayIndex
+	}
+
+	return cubeIndex
+}
+
+// HTML renders the legacy formatted message as HTML, with the text escaped
+// and styled with inline styles. Obfuscated text is given the
+// HTMLObfuscatedClass class, and new lines are rendered as line breaks.
+func HTML(message string) string {
+	var builder strings.Builder
+	texts, styles := styledRuns(legacyRunes(message))
+
+	for i, text := range texts {
+		escaped := strings.Replace(html.EscapeString(text), "\n", "<br>", -1)
+		css := htmlStyle(styles[i])
+		obfuscated := styles[i].decorations[DecorationObfuscated]
+
+		if css == "" && !obfuscated {
+			builder.WriteString(escaped)
+			continue
+		}
+
+		builder.WriteString("<span")
+		if obfuscated {
+			builder.WriteString(` class="` + HTMLObfuscatedClass + `"`)
+		}
+		if css != "" {
+			builder.WriteString(` style="` + css + `"`)
+		}
+		builder.WriteString(">" + escaped + "</span>")
+	}
+
+	return builder.String()
+}
+
+// HTML renders the component as HTML. See HTML.
+func (c Component) HTML() string {
+	return HTML(c.ToLegacy())
+}
+
+// htmlStyle returns the inline CSS for the style.
+func htmlStyle(s style) string {
+	var properties []string
+
+	if r, g, b, ok := s.color.RGB(); ok {
+		properties = append(properties, "color:"+string(RGB(r, g, b)))
+	}
+
+	if s.decorations[DecorationBold] {
+		properties = append(properties, "font-weight:bold")
+	}
+
+	if s.decorations[DecorationItalic] {
+		properties = append(properties, "font-style:italic")
+	}
+
+	var lines []string
+	if s.decorations[DecorationUnderlined] {
+		lines = append(lines, "underline")
+	}
+
+	if s.decorations[DecorationStrikethrough] {
+		lines = append(lines, "line-through")
+	}
+
+	if len(lines) > 0 {
+		properties = append(properties,
+			"text-decoration:"+strings.Join(lines, " "))
+	}
+
+	return strings.Join(properties, ";")
+}
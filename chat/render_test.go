@@ -0,0 +1,103 @@
+package chat
+
+import (
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		message   string
+		plain     string
+		trueColor string
+		ansi256   string
+		ansi16    string
+		html      string
+	}{
+		{"plain", "plain", "plain", "plain", "plain", "plain"},
+		{"§aGreen §lbold§r plain", "Green bold plain",
+			"\x1b[0;38;2;85;255;85mGreen \x1b[0;38;2;85;255;85;1mbold\x1b[0m plain",
+			"\x1b[0;38;5;83mGreen \x1b[0;38;5;83;1mbold\x1b[0m plain",
+			"\x1b[0;92mGreen \x1b[0;92;1mbold\x1b[0m plain",
+			`<span style="color:#55FF55">Green </span><span style="color:` +
+				`#55FF55;font-weight:bold">bold</span> plain`},
+		// Colors turn off decorations.
+		{"§lbold §cred", "bold red",
+			"\x1b[0;1mbold \x1b[0;38;2;255;85;85mred\x1b[0m",
+			"\x1b[0;1mbold \x1b[0;38;5;203mred\x1b[0m",
+			"\x1b[0;1mbold \x1b[0;91mred\x1b[0m",
+			`<span style="font-weight:bold">bold </span><span style=` +
+				`"color:#FF5555">red</span>`},
+		// Hex colors use the nearest of the 16 colors.
+		{"§x§f§f§8§0§0§0hex §x§2§0§2§0§2§0dark", "hex dark",
+			"\x1b[0;38;2;255;128;0mhex \x1b[0;38;2;32;32;32mdark\x1b[0m",
+			"\x1b[0;38;5;208mhex \x1b[0;38;5;234mdark\x1b[0m",
+			"\x1b[0;33mhex \x1b[0;30mdark\x1b[0m",
+			`<span style="color:#FF8000">hex </span><span style="color:` +
+				`#202020">dark</span>`},
+		{"§kobf§r §n§munder strike", "obf under strike",
+			"\x1b[0;5mobf\x1b[0m \x1b[0;9;4munder strike\x1b[0m",
+			"\x1b[0;5mobf\x1b[0m \x1b[0;9;4munder strike\x1b[0m",
+			"\x1b[0;5mobf\x1b[0m \x1b[0;9;4munder strike\x1b[0m",
+			`<span class="mc-obfuscated">obf</span> <span style=` +
+				`"text-decoration:underline line-through">under strike</span>`},
+		{"§k§6gold§kobf", "goldobf",
+			"\x1b[0;38;2;255;170;0mgold\x1b[0;38;2;255;170;0;5mobf\x1b[0m",
+			"\x1b[0;38;5;214mgold\x1b[0;38;5;214;5mobf\x1b[0m",
+			"\x1b[0;33mgold\x1b[0;33;5mobf\x1b[0m",
+			`<span style="color:#FFAA00">gold</span><span class=` +
+				`"mc-obfuscated" style="color:#FFAA00">obf</span>`},
+		{"§o<&\"'>\nline", "<&\"'>\nline",
+			"\x1b[0;3m<&\"'>\nline\x1b[0m",
+			"\x1b[0;3m<&\"'>\nline\x1b[0m",
+			"\x1b[0;3m<&\"'>\nline\x1b[0m",
+			`<span style="font-style:italic">&lt;&amp;&#34;&#39;&gt;<br>` +
+				`line</span>`},
+		{"<b>&amp;", "<b>&amp;", "<b>&amp;", "<b>&amp;", "<b>&amp;",
+			"&lt;b&gt;&amp;amp;"},
+	}
+
+	for _, test := range tests {
+		results := []struct {
+			name     string
+			result   string
+			expected string
+		}{
+			{"Plain", Plain(test.message), test.plain},
+			{"ANSI(ANSITrueColor)", ANSI(test.message, ANSITrueColor),
+				test.trueColor},
+			{"ANSI(ANSI256)", ANSI(test.message, ANSI256), test.ansi256},
+			{"ANSI(ANSI16)", ANSI(test.message, ANSI16), test.ansi16},
+			{"HTML", HTML(test.message), test.html},
+		}
+
+		for _, result := range results {
+			if result.result != result.expected {
+				t.Errorf("%s(%q) = %q, want %q", result.name, test.message,
+					result.result, result.expected)
+			}
+		}
+	}
+}
+
+func TestANSI256Color(t *testing.T) {
+	tests := []struct {
+		r, g, b uint8
+		index   int
+	}{
+		{0, 0, 0, 16},
+		{255, 255, 255, 231},
+		{255, 0, 0, 196},
+		{95, 135, 175, 67},
+		// Grays are closer to the grayscale ramp than the cube.
+		{8, 8, 8, 232},
+		{128, 128, 128, 244},
+		{238, 238, 238, 255},
+	}
+
+	for _, test := range tests {
+		if index := ansi256Color(test.r, test.g, test.b); index != test.index {
+			t.Errorf("ansi256Color(%d, %d, %d) = %d, want %d", test.r, test.g,
+				test.b, index, test.index)
+		}
+	}
+}
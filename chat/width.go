@@ -0,0 +1,263 @@
+package chat
+
+import (
+	"strings"
+)
+
+// MOTDWidth is the width in pixels available to each line of the message
+// shown on the server list menu, at a GUI scale of 1.
+const MOTDWidth = 270
+
+// Ellipsis is appended to messages shortened by Truncate.
+const Ellipsis = "..."
+
+// glyphWidths are the widths in pixels of the characters of the default
+// Minecraft font that aren't the usual 6 pixels wide, including the pixel of
+// space after each character.
+var glyphWidths = map[rune]int{
+	'!': 2, '\'': 2, ',': 2, '.': 2, ':': 2, ';': 2, 'i': 2, '|': 2,
+	'`': 3, 'l': 3,
+	' ': 4, '"': 4, '(': 4, ')': 4, '*': 4, 'I': 4, '[': 4, ']': 4, 't': 4,
+	'<': 5, '>': 5, 'f': 5, 'k': 5, '{': 5, '}': 5,
+	'@': 7, '~': 7,
+}
+
+// defaultGlyphWidth is the width of characters not in glyphWidths.
+const defaultGlyphWidth = 6
+
+// GlyphWidth returns the width in pixels of the character when rendered in
+// the default Minecraft font, including the pixel of space after it. Bold
+// characters are a pixel wider.
+func GlyphWidth(r rune, bold bool) int {
+	width, found := glyphWidths[r]
+	if !found {
+		width = defaultGlyphWidth
+	}
+
+	if bold {
+		width++
+	}
+
+	return width
+}
+
+// styledRune is a character of a legacy formatted message with the style
+// it's displayed in.
+type styledRune struct {
+	r     rune
+	style style
+}
+
+// legacyRunes returns the characters of a legacy formatted message with
+// their styles.
+func legacyRunes(message string) []styledRune {
+	var result []styledRune
+	root := FromLegacy(message)
+
+	segments := root.Extra
+	if segments == nil {
+		segments = []Component{root}
+	}
+
+	empty := style{decorations: make(map[Decoration]bool)}
+	for _, segment := range segments {
+		segmentStyle := empty.with(segment)
+		for _, r := range segment.Text {
+			result = append(result, styledRune{r, segmentStyle})
+		}
+	}
+
+	return result
+}
+
+// runesWidth returns the width in pixels of the characters.
+func runesWidth(runes []styledRune) int {
+	width := 0
+	for _, r := range runes {
+		width += GlyphWidth(r.r, r.style.decorations[DecorationBold])
+	}
+
+	return width
+}
+
+// writeRunes writes the characters back into a legacy formatted message,
+// starting from the default style.
+func writeRunes(runes []styledRune) string {
+	var builder strings.Builder
+	current := style{decorations: make(map[Decoration]bool)}
+	for _, r := range runes {
+		builder.WriteString(legacyTransition(current, r.style))
+		builder.WriteRune(r.r)
+		current = r.style
+	}
+
+	return builder.String()
+}
+
+// Width returns the width in pixels of the legacy formatted message when
+// rendered in the default Minecraft font. For messages with multiple lines,
+// the width of the widest line is returned.
+func Width(message string) int {
+	widest := 0
+	for _, line := range splitLines(legacyRunes(message)) {
+		if width := runesWidth(line); width > widest {
+			widest = width
+		}
+	}
+
+	return widest
+}
+
+// Width returns the width in pixels of the component when rendered in the
+// default Minecraft font. See Width.
+func (c Component) Width() int {
+	return Width(c.ToLegacy())
+}
+
+// splitLines splits the characters at new lines.
+func splitLines(runes []styledRune) [][]styledRune {
+	lines := [][]styledRune{nil}
+	for _, r := range runes {
+		if r.r == '\n' {
+			lines = append(lines, nil)
+			continue
+		}
+
+		lines[len(lines)-1] = append(lines[len(lines)-1], r)
+	}
+
+	return lines
+}
+
+// Center pads the legacy formatted line with spaces so that it's centered
+// within the given width in pixels. Lines that are too wide are returned
+// as is.
+func Center(line string, width int) string {
+	padding := (width - Width(line)) / 2 / GlyphWidth(' ', false)
+	if padding <= 0 {
+		return line
+	}
+
+	return strings.Repeat(" ", padding) + line
+}
+
+// CenterMOTD centers each line of the legacy formatted message within the
+// message box on the server list menu.
+func CenterMOTD(message string) string {
+	styled := splitLines(legacyRunes(message))
+	lines := make([]string, len(styled))
+	for i := range styled {
+		// Each line is rewritten so that formatting carried over from the
+		// previous line comes after the padding.
+		lines[i] = Center(writeRunes(styled[i]), MOTDWidth)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Truncate shortens the legacy formatted line so that it fits within the
+// width in pixels, ending it with Ellipsis if it was shortened.
+func Truncate(line string, width int) string {
+	runes := legacyRunes(line)
+	if runesWidth(runes) <= width {
+		return line
+	}
+
+	for end := len(runes); end >= 0; end-- {
+		ellipsisStyle := style{decorations: make(map[Decoration]bool)}
+		if end > 0 {
+			ellipsisStyle = runes[end-1].style
+		}
+
+		truncated := append([]styledRune(nil), runes[:end]...)
+		for _, r := range Ellipsis {
+			truncated = append(truncated, styledRune{r, ellipsisStyle})
+		}
+
+		if runesWidth(truncated) <= width || end == 0 {
+			return writeRunes(truncated)
+		}
+	}
+
+	return ""
+}
+
+// Wrap word wraps the legacy formatted message into lines that fit within
+// the width in pixels, such as for disconnect messages. Formatting that is
+// active at a line break is carried over to the start of the next line, and
+// words too long for a line are broken up.
+func Wrap(message string, width int) []string {
+	var result []string
+
+	for _, paragraph := range splitLines(legacyRunes(message)) {
+		var line []styledRune
+		lineWidth := 0
+
+		for _, word := range splitWords(paragraph) {
+			wordWidth := runesWidth(word)
+			if lineWidth+wordWidth > width && len(line) > 0 {
+				result = append(result, writeRunes(trimTrailingSpaces(line)))
+				line = nil
+				lineWidth = 0
+				word = trimLeadingSpaces(word)
+				wordWidth = runesWidth(word)
+			}
+
+			for wordWidth > width && len(word) > 1 {
+				// Break up words that don't fit on a line by themselves.
+				end := 1
+				for end < len(word) && runesWidth(word[:end+1]) <= width {
+					end++
+				}
+
+				result = append(result, writeRunes(word[:end]))
+				word = word[end:]
+				wordWidth = runesWidth(word)
+			}
+
+			line = append(line, word...)
+			lineWidth += wordWidth
+		}
+
+		result = append(result, writeRunes(trimTrailingSpaces(line)))
+	}
+
+	return result
+}
+
+// splitWords splits the characters into words, each including the spaces
+// that precede it.
+func splitWords(runes []styledRune) [][]styledRune {
+	var words [][]styledRune
+	start := 0
+	for i := 1; i < len(runes); i++ {
+		if runes[i].r == ' ' && runes[i-1].r != ' ' {
+			words = append(words, runes[start:i])
+			start = i
+		}
+	}
+
+	if start < len(runes) {
+		words = append(words, runes[start:])
+	}
+
+	return words
+}
+
+// trimLeadingSpaces removes the spaces at the start of the characters.
+func trimLeadingSpaces(runes []styledRune) []styledRune {
+	for len(runes) > 0 && runes[0].r == ' ' {
+		runes = runes[1:]
+	}
+
+	return runes
+}
+
+// trimTrailingSpaces removes the spaces at the end of the characters.
+func trimTrailingSpaces(runes []styledRune) []styledRune {
+	for len(runes) > 0 && runes[len(runes)-1].r == ' ' {
+		runes = runes[:len(runes)-1]
+	}
+
+	return runes
+}
@@ -0,0 +1,40 @@
+package chat
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCenterMOTD(t *testing.T) {
+	tests := []struct {
+		message string
+		lines   []string
+	}{
+		{"abc\ndef", []string{"abc", "def"}},
+		{"§ahello\nworld", []string{"§ahello", "§aworld"}},
+		// A trailing § isn't a format code, and is kept as is.
+		{"abc§", []string{"abc§"}},
+		{"§", []string{"§"}},
+		// A § before a new line consumes it as a format code, so the
+		// message is a single line.
+		{"abc§\ndef", []string{"abcdef"}},
+		{"§\n", []string{""}},
+	}
+
+	for _, test := range tests {
+		centered := CenterMOTD(test.message)
+		lines := strings.Split(centered, "\n")
+		if len(lines) != len(test.lines) {
+			t.Errorf("CenterMOTD(%q) = %q, want %d lines", test.message,
+				centered, len(test.lines))
+			continue
+		}
+
+		for i, line := range lines {
+			if strings.TrimLeft(line, " ") != test.lines[i] {
+				t.Errorf("CenterMOTD(%q) line %d = %q, want %q padded",
+					test.message, i, line, test.lines[i])
+			}
+		}
+	}
+}
@@ -3,6 +3,7 @@
 package handler
 
 import (
+	"github.com/1lann/beacon/chat"
 	"github.com/1lann/beacon/ping"
 	"github.com/1lann/beacon/protocol"
 	"io"
@@ -17,24 +18,41 @@ import (
 type Player struct {
 	IPAddress      string
 	Username       string
+	UUID           string
 	Hostname       string
+	ProtocolNumber int
 	ShouldClose    bool
 	ForwardAddress string
 	InitialPacket  *protocol.Packet
-	State          int
+	State          State
 	Stream         protocol.Stream
 	Connection     net.Conn
+	// Legacy is true for pre-1.7 clients, whose ProtocolNumber is from the
+	// legacy protocol (or 0 if the client did not send it), and whose
+	// InitialPacket contains the raw data they sent.
+	Legacy bool
+
+	forwardData []byte
 }
 
 // A Handler is used for handling when a player attempts to connect to the
 // server. See Handle.
 type Handler func(player *Player) (message string)
 
+// A ComponentHandler is a Handler that returns a text component as the
+// message to be displayed to the player. See HandleComponent.
+type ComponentHandler func(player *Player) (message chat.Component)
+
 var statuses = make(map[string]*ping.Status)
-var handlers = make(map[string]Handler)
+var handlers = make(map[string]ComponentHandler)
 var forwarders = make(map[string]string)
 var listener net.Listener
 
+// noServerMessage is displayed to players connecting with a hostname that
+// has no handler.
+const noServerMessage = "Connection rejected. " +
+	"There is no server on this hostname."
+
 // OnForwardConnect is called whenever a connection is forwarded to
 // the given IP address, excluding server list pings.
 var OnForwardConnect func(ipAddress string)
@@ -98,6 +116,14 @@ func ClearStatus(hostnames []string) {
 // should return the message to be displayed to the player. Overrides any
 // handlers set by Forward.
 func Handle(hostnames []string, handler Handler) {
+	HandleComponent(hostnames, func(player *Player) chat.Component {
+		return chat.Text(handler(player))
+	})
+}
+
+// HandleComponent is like Handle, but the handler function returns a text
+// component to be displayed to the player.
+func HandleComponent(hostnames []string, handler ComponentHandler) {
 	for _, hostname := range hostnames {
 		hostname = strings.ToLower(hostname)
 
@@ -146,19 +172,39 @@ func handleConnection(conn net.Conn) {
 
 	player := &Player{
 		IPAddress:   strings.Split(conn.RemoteAddr().String(), ":")[0],
-		Stream:      protocol.NewStream(conn),
+		Stream:      protocol.NewBufferedStream(conn),
 		Connection:  conn,
 		ShouldClose: false,
-		State:       1,
+		State:       Handshaking,
+	}
+	defer player.Stream.Release()
+
+	packetID, err := player.Stream.ReadByte()
+	if err != nil {
+		if err != io.EOF {
+			log.Println("beacon: Failed to read first byte:", err)
+		}
+		return
+	}
+
+	// The first byte is unread before peeking at the rest, as peeking
+	// prevents it from being unread afterwards. Unless the connection is
+	// from a legacy client, it's part of the length of a regular packet.
+	player.Stream.UnreadByte()
+	if packetID == ping.LegacyLoginID || (packetID == ping.LegacyPingID &&
+		isLegacyPing(player.Stream.Buffered()[1:])) {
+		player.Stream.ReadByte()
+		handleLegacyConnection(player, packetID)
+		return
 	}
 
-packetLoop:
 	for {
 		if player.ShouldClose {
 			return
 		}
 
-		packetStream, _, err := player.Stream.GetPacketStream()
+		packetStream, _, err := player.Stream.GetPacketStreamLimit(
+			protocol.MaxPacketSizeFor(player.State))
 
 		if err != nil {
 			if err == io.EOF {
@@ -169,30 +215,13 @@ packetLoop:
 			return
 		}
 
-		packetID, err := packetStream.ReadVarInt()
-		if err != nil {
-			log.Println("beacon: Failed to read packet ID:", err)
+		if err := dispatchPacket(player, packetStream); err != nil {
+			log.Println("beacon: Closing connection:", err)
 			return
 		}
 
-		switch packetID {
-		case 0:
-			err := handlePacketID0(player, packetStream)
-			if err != nil {
-				log.Println("beacon: Failed to handle packet ID 0:", err)
-			}
-
-			if player.ForwardAddress != "" {
-				break packetLoop
-			}
-		case 1:
-			if err := handlePacketID1(player, packetStream); err != nil {
-				log.Println("beacon: Failed to handle packet ID 1:", err)
-			}
-		case 122:
-			return
-		default:
-			log.Println("beacon: Unknown packet ID:", packetID)
+		if player.ForwardAddress != "" {
+			break
 		}
 
 		numBytes, err := packetStream.ExhaustPacket()
@@ -204,99 +233,14 @@ packetLoop:
 		}
 	}
 
-	forwardConnection(player)
-}
-
-func handlePacketID0(player *Player, ps protocol.PacketStream) error {
-	if ps.GetRemainingBytes() == 0 {
-		if player.State != 1 {
-			return nil
-		}
-
-		status, found := statuses[player.Hostname]
-		if !found {
-			player.ShouldClose = true
-			return nil
-		}
-
-		err := ping.WriteHandshakeResponse(ps.Stream, *status)
-		if err != nil {
-			return err
-		}
-
-		return nil
-	}
-
-	switch player.State {
-	case 1:
-		handshake, err := ping.ReadHandshakePacket(ps.Stream)
-		if err != nil {
-			log.Println("beacon: Handshake packet read error:", err)
-		}
-
-		player.Hostname = strings.ToLower(handshake.ServerAddress)
-
-		if address, found := forwarders[player.Hostname]; found {
-			// Write the handshake data
-			initialPacket := protocol.NewPacketWithID(0x00)
-			initialPacket.WriteVarInt(handshake.ProtocolNumber)
-			initialPacket.WriteString(handshake.ServerAddress)
-			initialPacket.WriteUInt16(handshake.ServerPort)
-			initialPacket.WriteVarInt(handshake.NextState)
-			player.InitialPacket = initialPacket
-			player.ForwardAddress = address
-			player.State = handshake.NextState
-			return nil
-		}
-
-		if handshake.NextState == 1 {
-			player.State = 1
-		} else if handshake.NextState == 2 {
-			player.State = 2
-		}
-	case 2:
-		username, err := ps.ReadString()
-		if err != nil {
-			return err
-		}
-
-		player.Username = username
-
-		handler, found := handlers[player.Hostname]
-		if !found {
-			log.Println("beacon: Missing handler for hostname: " +
-				player.Hostname)
-			err := ping.DisplayMessage(ps.Stream,
-				"Connection rejected. There is no server on this hostname.")
-			if err != nil {
-				return err
-			}
-
-			return nil
-		}
-
-		err = ping.DisplayMessage(ps.Stream, handler(player))
-		if err != nil {
-			return err
-		}
-	}
-
-	return nil
-}
-
-func handlePacketID1(player *Player, ps protocol.PacketStream) error {
-	if ps.GetRemainingBytes() == 0 {
-		return nil
-	}
-
-	status, found := statuses[player.Hostname]
-	if !found {
-		status = &ping.Status{
-			ShowConnection: false,
+	if player.loggingIn() {
+		if err := readForwardedLogin(player); err != nil {
+			log.Println("beacon: Failed to read forwarded login:", err)
+			return
 		}
 	}
 
-	return ping.HandlePingPacket(ps.Stream, *status)
+	forwardConnection(player)
 }
 
 func forwardConnection(player *Player) {
@@ -306,7 +250,7 @@ func forwardConnection(player *Player) {
 		return
 	}
 
-	if OnForwardConnect != nil && player.State == 2 {
+	if OnForwardConnect != nil && player.loggingIn() {
 		go OnForwardConnect(player.ForwardAddress)
 		startTime := time.Now()
 
@@ -321,15 +265,34 @@ func forwardConnection(player *Player) {
 	defer remoteConn.Close()
 	defer player.Connection.Close()
 
-	lengthPacket := &protocol.Packet{}
-	lengthPacket.WriteVarInt(len(player.InitialPacket.Data))
+	if player.Legacy {
+		_, err = remoteConn.Write(player.InitialPacket.Data)
+	} else {
+		err = protocol.NewStream(remoteConn).WritePacket(player.InitialPacket)
+	}
 
-	_, err = remoteConn.Write(append(lengthPacket.Data,
-		player.InitialPacket.Data...))
 	if err != nil {
 		return
 	}
 
+	if len(player.forwardData) > 0 {
+		if _, err = remoteConn.Write(player.forwardData); err != nil {
+			return
+		}
+	}
+
+	// Data that was read ahead from the player is sent before the rest of
+	// the connection is copied.
+	if buffered := player.Stream.Buffered(); len(buffered) > 0 {
+		if _, err = remoteConn.Write(buffered); err != nil {
+			return
+		}
+	}
+
+	if player.loggingIn() {
+		defer addSession(player)()
+	}
+
 	connChannel := make(chan bool)
 	connOpen := true
 
@@ -0,0 +1,336 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/1lann/beacon/ping"
+	"github.com/1lann/beacon/protocol"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// connect starts handling a connection, and returns the client's side of it.
+func connect(t *testing.T) net.Conn {
+	client, server := net.Pipe()
+	go handleConnection(server)
+	t.Cleanup(func() { client.Close() })
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+	return client
+}
+
+// readKick reads a legacy kick packet, and returns its message.
+func readKick(t *testing.T, conn net.Conn) string {
+	s := protocol.NewStream(conn)
+	id, err := s.ReadByte()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if id != ping.LegacyKickID {
+		t.Fatalf("packet ID = %#x, want %#x", id, ping.LegacyKickID)
+	}
+
+	message, err := s.ReadLegacyString()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return message
+}
+
+// legacyPing16 returns a legacy ping sent by a 1.6 client.
+func legacyPing16(address string) []byte {
+	host := &protocol.Packet{}
+	host.WriteByte(78)
+	host.WriteLegacyString(address)
+	host.WriteInt32(25565)
+
+	p := &protocol.Packet{}
+	p.WriteByte(ping.LegacyPingID)
+	p.WriteByte(0x01)
+	p.WriteByte(0xFA)
+	p.WriteLegacyString("MC|PingHost")
+	p.WriteUInt16(uint16(len(host.Data)))
+	p.Data = append(p.Data, host.Data...)
+	return p.Data
+}
+
+func TestIsLegacyPing(t *testing.T) {
+	tests := []struct {
+		data   []byte
+		legacy bool
+	}{
+		{nil, true},
+		{[]byte{0x01}, true},
+		{[]byte{0x01, 0xFA}, true},
+		{[]byte{0x01, 0xFA, 0x00}, true},
+		{[]byte{0x00}, false},
+		{[]byte{0x02, 0x00}, false},
+		{[]byte{0x01, 0x00}, false},
+		{[]byte{0x01, 0x00, 0xFF, 0x05}, false},
+	}
+
+	for _, test := range tests {
+		if legacy := isLegacyPing(test.data); legacy != test.legacy {
+			t.Errorf("isLegacyPing(% x) = %v, want %v", test.data, legacy,
+				test.legacy)
+		}
+	}
+}
+
+func TestLegacyPing(t *testing.T) {
+	SetStatus([]string{LegacyHostname, "legacy.example.com"}, &ping.Status{
+		OnlinePlayers: 1,
+		MaxPlayers:    20,
+		Message:       "§aMOTD",
+		VersionName:   "beacon",
+	})
+	defer ClearStatus([]string{LegacyHostname, "legacy.example.com"})
+
+	tests := []struct {
+		name    string
+		data    []byte
+		message string
+	}{
+		{"beta", []byte{0xFE}, "MOTD§1§20"},
+		{"1.4", []byte{0xFE, 0x01}, "§1\x00127\x00beacon\x00§aMOTD\x001\x0020"},
+		{"1.6", legacyPing16("legacy.example.com"),
+			"§1\x00127\x00beacon\x00§aMOTD\x001\x0020"},
+	}
+
+	for _, test := range tests {
+		conn := connect(t)
+		start := time.Now()
+		if _, err := conn.Write(test.data); err != nil {
+			t.Fatal(err)
+		}
+
+		if message := readKick(t, conn); message != test.message {
+			t.Errorf("%s: message = %q, want %q", test.name, message,
+				test.message)
+		}
+
+		// Pings that have been received in full are responded to without
+		// waiting for the rest of a 1.6 ping.
+		if elapsed := time.Since(start); elapsed >= legacyPingTimeout {
+			t.Errorf("%s: response took %v", test.name, elapsed)
+		}
+	}
+}
+
+// TestHandshakeLength254 tests that a regular packet that is 254 bytes long,
+// whose length is encoded as FE 01, isn't mistaken for a legacy ping.
+func TestHandshakeLength254(t *testing.T) {
+	// The packet ID, protocol number, address length, port and next state
+	// take up 8 bytes.
+	address := strings.Repeat("a", 246)
+	SetStatus([]string{address}, &ping.Status{Message: "modern"})
+	defer ClearStatus([]string{address})
+
+	handshake := protocol.NewPacketWithID(0x00)
+	err := protocol.Marshal(handshake, ping.HandshakePacket{
+		ProtocolNumber: 767,
+		ServerAddress:  address,
+		ServerPort:     25565,
+		NextState:      int(Status),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	s := protocol.NewStream(&buf)
+	s.WritePacket(handshake)
+	s.WritePacket(protocol.NewPacketWithID(0x00))
+	if !bytes.HasPrefix(buf.Bytes(), []byte{0xFE, 0x01, 0x00}) {
+		t.Fatalf("handshake starts with % x, want fe 01 00", buf.Bytes()[:3])
+	}
+
+	conn := connect(t)
+	if _, err := conn.Write(buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+
+	ps, _, err := protocol.NewStream(conn).GetPacketStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if id, err := ps.ReadVarInt(); err != nil || id != 0x00 {
+		t.Fatalf("packet ID = %#x, %v, want 0x00", id, err)
+	}
+
+	data, err := ps.ReadString()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var response struct {
+		Description json.RawMessage
+	}
+	if err := json.Unmarshal([]byte(data), &response); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Contains(response.Description, []byte("modern")) {
+		t.Errorf("description = %s, want it to contain modern",
+			response.Description)
+	}
+}
+
+// TestHandlePacketRace tests that hooks can be set and replaced while
+// connections are dispatching packets, when run with -race.
+func TestHandlePacketRace(t *testing.T) {
+	SetStatus([]string{"race.example.com"}, &ping.Status{
+		Message:        "race",
+		ShowConnection: true,
+	})
+	defer ClearStatus([]string{"race.example.com"})
+	defer HandlePacket(Status, "ping_request", handlePingRequest)
+
+	var buf bytes.Buffer
+	s := protocol.NewStream(&buf)
+	handshake := protocol.NewPacketWithID(0x00)
+	err := protocol.Marshal(handshake, ping.HandshakePacket{
+		ProtocolNumber: 767,
+		ServerAddress:  "race.example.com",
+		ServerPort:     25565,
+		NextState:      int(Status),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.WritePacket(handshake)
+	s.WritePacket(protocol.NewPacketWithID(0x00))
+	pingRequest := protocol.NewPacketWithID(0x01)
+	pingRequest.WriteInt64(42)
+	s.WritePacket(pingRequest)
+
+	var hooked int32
+	hook := func(player *Player, ps protocol.PacketStream,
+		value interface{}) error {
+		atomic.AddInt32(&hooked, 1)
+		return handlePingRequest(player, ps, value)
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+
+			if i%2 == 0 {
+				HandlePacket(Status, "ping_request", hook)
+				HandlePacket(Configuration, "race", hook)
+			} else {
+				HandlePacket(Status, "ping_request", handlePingRequest)
+				HandlePacket(Configuration, "race", nil)
+			}
+		}
+	}()
+
+	const connections = 50
+	errs := make(chan error, connections)
+	for i := 0; i < connections; i++ {
+		go func() {
+			conn := connect(t)
+			if _, err := conn.Write(buf.Bytes()); err != nil {
+				errs <- err
+				return
+			}
+
+			s := protocol.NewStream(conn)
+			for _, id := range []int{0x00, 0x01} {
+				ps, _, err := s.GetPacketStream()
+				if err != nil {
+					errs <- err
+					return
+				}
+
+				if packetID, err := ps.ReadVarInt(); err != nil ||
+					packetID != id {
+					errs <- fmt.Errorf("packet ID = %#x, %v, want %#x",
+						packetID, err, id)
+					return
+				}
+
+				ps.ExhaustPacket()
+			}
+
+			errs <- nil
+		}()
+	}
+
+	for i := 0; i < connections; i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+
+	close(done)
+	wg.Wait()
+	t.Logf("%d of %d pings handled by the replaced hook",
+		atomic.LoadInt32(&hooked), connections)
+}
+
+// TestSampleSessionsRace tests that the sessions shown in the player sample
+// can be changed while statuses are being sent, when run with -race.
+func TestSampleSessionsRace(t *testing.T) {
+	hostnames := []string{"sample.example.com"}
+	defer SampleSessions(hostnames)
+
+	player := &Player{Username: "Notch", ForwardAddress: "127.0.0.1:25566"}
+	defer addSession(player)()
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+
+			if i%2 == 0 {
+				SampleSessions(hostnames, player.ForwardAddress)
+			} else {
+				SampleSessions(hostnames)
+			}
+		}
+	}()
+
+	var sampled int32
+	var readers sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for j := 0; j < 100; j++ {
+				status := withSessionSample(hostnames[0], ping.Status{})
+				if len(status.Sample) > 0 {
+					atomic.AddInt32(&sampled, 1)
+				}
+			}
+		}()
+	}
+
+	readers.Wait()
+	close(done)
+	wg.Wait()
+	t.Logf("%d of 800 statuses sampled the session",
+		atomic.LoadInt32(&sampled))
+}
@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"bytes"
+	"github.com/1lann/beacon/ping"
+	"github.com/1lann/beacon/protocol"
+	"io"
+	"log"
+	"strings"
+	"time"
+)
+
+// LegacyHostname is the hostname used to find the status and handler for
+// legacy (pre-1.7) clients that do not send the address they are
+// connecting to, which are clients older than 1.6 for server list pings,
+// and clients older than 1.0 for logins.
+var LegacyHostname = ""
+
+// legacyPingTimeout is how long to wait for the remainder of a 1.6 legacy
+// server list ping.
+const legacyPingTimeout = 500 * time.Millisecond
+
+type readWriter struct {
+	io.Reader
+	io.Writer
+}
+
+// legacyHostname returns the hostname used for a legacy client connecting
+// to the given address.
+func legacyHostname(address string) string {
+	if address == "" {
+		return strings.ToLower(LegacyHostname)
+	}
+
+	return strings.ToLower(address)
+}
+
+// isLegacyPing returns whether a connection that starts with 0xFE is a
+// legacy server list ping, given the data received after the 0xFE. 0xFE is
+// also the first byte of the length of a regular packet that is 126, 254,
+// 382 (and so on) bytes long. Like the vanilla server, only the data that
+// has already been received is checked, as clients older than 1.6 send
+// FE or FE 01 and wait for a response, while 1.6 clients send FE 01 FA
+// followed by the rest of the ping at once.
+func isLegacyPing(data []byte) bool {
+	switch {
+	case len(data) == 0:
+		return true
+	case data[0] != 0x01:
+		return false
+	case len(data) == 1:
+		return true
+	}
+
+	return data[1] == 0xFA
+}
+
+func handleLegacyConnection(player *Player, packetID byte) {
+	player.Legacy = true
+
+	// Everything read is recorded so that it can be forwarded verbatim.
+	recorded := &bytes.Buffer{}
+	recorded.WriteByte(packetID)
+	stream := protocol.NewStream(readWriter{
+		io.TeeReader(player.Stream, recorded), player.Connection})
+
+	switch packetID {
+	case ping.LegacyPingID:
+		player.State = Status
+
+		// Pings from clients older than 1.6 have already been received in
+		// full, so they're read without waiting for more data.
+		deadline := time.Now()
+		if len(player.Stream.Buffered()) >= 2 {
+			deadline = deadline.Add(legacyPingTimeout)
+		}
+
+		player.Connection.SetReadDeadline(deadline)
+		legacyPing, err := ping.ReadLegacyPingPacket(stream)
+		player.Connection.SetReadDeadline(time.Time{})
+		if err != nil {
+			log.Println("beacon: Legacy ping packet read error:", err)
+			return
+		}
+
+		player.Hostname = legacyHostname(legacyPing.ServerAddress)
+		player.ProtocolNumber = legacyPing.ProtocolNumber
+
+		if address, found := forwarders[player.Hostname]; found {
+			forwardLegacyConnection(player, address, recorded.Bytes())
+			return
+		}
+
+		status, found := statuses[player.Hostname]
+		if !found {
+			return
+		}
+
+		err = ping.WriteLegacyHandshakeResponse(stream, *status, legacyPing)
+		if err != nil {
+			log.Println("beacon: Failed to respond to legacy ping:", err)
+		}
+	case ping.LegacyLoginID:
+		player.State = Login
+
+		login, err := ping.ReadLegacyLoginPacket(stream)
+		if err != nil {
+			log.Println("beacon: Legacy login packet read error:", err)
+			return
+		}
+
+		player.Username = login.Username
+		player.UUID = ping.OfflineUUID(login.Username)
+		player.Hostname = legacyHostname(login.ServerAddress)
+		player.ProtocolNumber = login.ProtocolNumber
+
+		if address, found := forwarders[player.Hostname]; found {
+			forwardLegacyConnection(player, address, recorded.Bytes())
+			return
+		}
+
+		message := noServerMessage
+		if handler, found := handlers[player.Hostname]; found {
+			message = handler(player).Downsample().ToLegacy()
+		} else {
+			log.Println("beacon: Missing handler for hostname: " +
+				player.Hostname)
+		}
+
+		err = ping.DisplayLegacyMessage(stream, message)
+		if err != nil {
+			log.Println("beacon: Failed to display legacy message:", err)
+		}
+	}
+}
+
+func forwardLegacyConnection(player *Player, address string, data []byte) {
+	player.ForwardAddress = address
+	player.InitialPacket = &protocol.Packet{Data: data}
+	forwardConnection(player)
+}
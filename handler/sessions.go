@@ -0,0 +1,176 @@
+package handler
+
+import (
+	"github.com/1lann/beacon/ping"
+	"github.com/1lann/beacon/protocol"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Session is the information of a player whose connection is currently
+// being forwarded to another server. See Sessions.
+type Session struct {
+	Username       string
+	UUID           string
+	IPAddress      string
+	Hostname       string
+	ForwardAddress string
+	Started        time.Time
+}
+
+// maxSampleSize is the number of players vanilla servers show at most in
+// the player sample.
+const maxSampleSize = 12
+
+var sessionsMutex sync.Mutex
+var sessions = make(map[*Player]Session)
+
+// sampleAddresses maps hostnames to the forward addresses whose sessions are
+// shown in their player sample. It's guarded by sampleMutex, as it can be
+// set while connections are being handled.
+var sampleMutex sync.RWMutex
+var sampleAddresses = make(map[string][]string)
+
+// Sessions returns the players that are currently being forwarded to
+// another server, ordered by when they connected.
+func Sessions() []Session {
+	sessionsMutex.Lock()
+	defer sessionsMutex.Unlock()
+
+	result := make([]Session, 0, len(sessions))
+	for _, session := range sessions {
+		result = append(result, session)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Started.Before(result[j].Started)
+	})
+
+	return result
+}
+
+// SampleSessions shows the players that are currently being forwarded to
+// any of the given addresses in the player sample of the status for the
+// given hostnames, after the status's own Sample. Calling SampleSessions
+// without any addresses stops showing them. It's safe to call while
+// connections are being handled.
+func SampleSessions(hostnames []string, addresses ...string) {
+	addresses = append([]string(nil), addresses...)
+
+	sampleMutex.Lock()
+	defer sampleMutex.Unlock()
+
+	for _, hostname := range hostnames {
+		hostname = strings.ToLower(hostname)
+
+		if len(addresses) == 0 {
+			delete(sampleAddresses, hostname)
+			continue
+		}
+
+		sampleAddresses[hostname] = addresses
+	}
+}
+
+// withSessionSample returns the status with the forwarded players chosen by
+// SampleSessions added to its sample.
+func withSessionSample(hostname string, status ping.Status) ping.Status {
+	sampleMutex.RLock()
+	addresses, found := sampleAddresses[hostname]
+	sampleMutex.RUnlock()
+
+	if !found {
+		return status
+	}
+
+	sample := append([]ping.PlayerSample(nil), status.Sample...)
+
+	for _, session := range Sessions() {
+		if len(sample) >= maxSampleSize {
+			break
+		}
+
+		for _, address := range addresses {
+			if session.ForwardAddress == address {
+				sample = append(sample, ping.PlayerSample{
+					Name: session.Username,
+					ID:   session.UUID,
+				})
+				break
+			}
+		}
+	}
+
+	status.Sample = sample
+	return status
+}
+
+// addSession records the player as being forwarded, and returns a function
+// that removes them once their connection is closed.
+func addSession(player *Player) func() {
+	sessionsMutex.Lock()
+	defer sessionsMutex.Unlock()
+
+	sessions[player] = Session{
+		Username:       player.Username,
+		UUID:           player.UUID,
+		IPAddress:      player.IPAddress,
+		Hostname:       player.Hostname,
+		ForwardAddress: player.ForwardAddress,
+		Started:        time.Now(),
+	}
+
+	return func() {
+		sessionsMutex.Lock()
+		defer sessionsMutex.Unlock()
+		delete(sessions, player)
+	}
+}
+
+// readForwardedLogin reads the login start packet of a player who is about
+// to be forwarded, so that their username and UUID are known. The packet is
+// kept to be forwarded along with the initial packet.
+func readForwardedLogin(player *Player) error {
+	ps, length, err := player.Stream.GetPacketStreamLimit(
+		protocol.MaxPacketSizeFor(player.State))
+	if err != nil {
+		return err
+	}
+
+	data := make([]byte, length)
+	if err := ps.ReadFull(data); err != nil {
+		return err
+	}
+
+	framed := &protocol.Packet{}
+	framed.WriteVarInt(length)
+	framed.Write(data)
+	player.forwardData = framed.Data
+
+	s := protocol.NewSliceStream(data)
+	packetID, err := s.ReadVarInt()
+	if err != nil {
+		return err
+	}
+
+	id, _ := protocol.ID(player.ProtocolNumber, protocol.StateLogin,
+		protocol.Serverbound, "login_start")
+	if packetID != id {
+		return nil
+	}
+
+	login, err := ping.ReadLoginStartPacket(s.Stream, player.ProtocolNumber)
+	if err != nil {
+		return err
+	}
+
+	player.Username = login.Username
+	player.UUID = login.UUID
+	if player.UUID == "" {
+		player.UUID = ping.OfflineUUID(player.Username)
+	}
+
+	return nil
+}
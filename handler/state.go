@@ -0,0 +1,193 @@
+package handler
+
+import (
+	"fmt"
+	"github.com/1lann/beacon/chat"
+	"github.com/1lann/beacon/ping"
+	"github.com/1lann/beacon/protocol"
+	"github.com/1lann/beacon/versions"
+	"log"
+	"strings"
+	"sync"
+)
+
+// State is the state of a player's connection, which determines the
+// packets they may send.
+type State = protocol.State
+
+// The states of a player's connection. Players start in Handshaking, and
+// move to Status, Login or Transfer depending on their handshake.
+const (
+	Handshaking   = protocol.StateHandshaking
+	Status        = protocol.StateStatus
+	Login         = protocol.StateLogin
+	Transfer      = protocol.StateTransfer
+	Configuration = protocol.StateConfiguration
+)
+
+// A PacketHook handles a packet sent by a player. The decoded packet is
+// given as value if the packet has a decoder in the protocol registry,
+// otherwise its fields can be read from ps. Returning an error closes the
+// connection.
+type PacketHook func(player *Player, ps protocol.PacketStream,
+	value interface{}) error
+
+// dispatch maps each state to the hooks for the packets that are accepted
+// in it, by the name of the packet in the protocol registry. It's guarded by
+// dispatchMutex, as hooks can be set while connections are being handled.
+var dispatchMutex sync.RWMutex
+var dispatch = map[State]map[string]PacketHook{
+	Handshaking: {
+		"handshake": handleHandshake,
+	},
+	Status: {
+		"status_request": handleStatusRequest,
+		"ping_request":   handlePingRequest,
+	},
+	Login: {
+		"login_start": handleLoginStart,
+	},
+	Transfer: {
+		"login_start": handleLoginStart,
+	},
+	Configuration: {},
+}
+
+// HandlePacket sets the hook that is called when a player sends the named
+// packet while their connection is in the state, replacing any existing
+// hook for it, including those used by beacon. The packet must be defined
+// in the protocol registry for the player's version. Setting a nil hook
+// removes it, after which the packet closes the connection. It's safe to
+// call while connections are being handled.
+func HandlePacket(state State, name string, hook PacketHook) {
+	dispatchMutex.Lock()
+	defer dispatchMutex.Unlock()
+
+	hooks, found := dispatch[state]
+	if !found {
+		hooks = make(map[string]PacketHook)
+		dispatch[state] = hooks
+	}
+
+	if hook == nil {
+		delete(hooks, name)
+		return
+	}
+
+	hooks[name] = hook
+}
+
+// dispatchPacket reads the next packet sent by the player and calls the
+// hook for it. An error is returned for packets that aren't valid in the
+// player's state, in which case the connection should be closed.
+func dispatchPacket(player *Player, ps protocol.PacketStream) error {
+	definition, value, err := protocol.ReadPacket(ps, player.ProtocolNumber,
+		player.State, protocol.Serverbound)
+	if err != nil {
+		return err
+	}
+
+	dispatchMutex.RLock()
+	hook, found := dispatch[player.State][definition.Name]
+	dispatchMutex.RUnlock()
+
+	if !found {
+		return fmt.Errorf("unexpected %s packet in %s state from %s client",
+			definition.Name, player.State,
+			versions.Name(player.ProtocolNumber))
+	}
+
+	if err := hook(player, ps, value); err != nil {
+		return fmt.Errorf("%s packet: %v", definition.Name, err)
+	}
+
+	return nil
+}
+
+// loggingIn returns whether the player's handshake was for a login.
+func (p *Player) loggingIn() bool {
+	return p.State == Login || p.State == Transfer
+}
+
+// Disconnect disconnects the player with the message, using the disconnect
+// packet of the player's version and connection state. It can be used by
+// packet hooks in the Login, Transfer and Configuration states.
+func (p *Player) Disconnect(message chat.Component) error {
+	p.ShouldClose = true
+	return ping.Disconnect(p.Stream, message, p.ProtocolNumber, p.State)
+}
+
+func handleHandshake(player *Player, ps protocol.PacketStream,
+	value interface{}) error {
+	handshake := value.(ping.HandshakePacket)
+
+	switch State(handshake.NextState) {
+	case Status, Login, Transfer:
+	default:
+		return fmt.Errorf("invalid next state %d", handshake.NextState)
+	}
+
+	if versions.IsSnapshot(handshake.ProtocolNumber) {
+		log.Println("beacon: Client connecting with snapshot",
+			versions.Name(handshake.ProtocolNumber))
+	}
+
+	player.Hostname = strings.ToLower(handshake.ServerAddress)
+	player.ProtocolNumber = handshake.ProtocolNumber
+	player.State = State(handshake.NextState)
+
+	if address, found := forwarders[player.Hostname]; found {
+		// Write the handshake data
+		initialPacket := protocol.NewPacketWithID(0x00)
+		if err := protocol.Marshal(initialPacket, handshake); err != nil {
+			return err
+		}
+		player.InitialPacket = initialPacket
+		player.ForwardAddress = address
+	}
+
+	return nil
+}
+
+func handleStatusRequest(player *Player, ps protocol.PacketStream,
+	value interface{}) error {
+	status, found := statuses[player.Hostname]
+	if !found {
+		player.ShouldClose = true
+		return nil
+	}
+
+	return ping.WriteStatusResponse(ps.Stream,
+		withSessionSample(player.Hostname, *status), player.ProtocolNumber)
+}
+
+func handlePingRequest(player *Player, ps protocol.PacketStream,
+	value interface{}) error {
+	status, found := statuses[player.Hostname]
+	if !found {
+		status = &ping.Status{
+			ShowConnection: false,
+		}
+	}
+
+	return ping.HandlePingPacket(ps.Stream, *status)
+}
+
+func handleLoginStart(player *Player, ps protocol.PacketStream,
+	value interface{}) error {
+	login := value.(ping.LoginStartPacket)
+	player.Username = login.Username
+	player.UUID = login.UUID
+	if player.UUID == "" {
+		player.UUID = ping.OfflineUUID(player.Username)
+	}
+
+	handler, found := handlers[player.Hostname]
+	if !found {
+		log.Println("beacon: Missing handler for hostname: " +
+			player.Hostname)
+		return player.Disconnect(chat.Text(noServerMessage))
+	}
+
+	return player.Disconnect(handler(player))
+}
@@ -0,0 +1,52 @@
+// Package resize implements resizing images for server icons and chat
+// images.
+package resize
+
+import (
+	"image"
+	"image/color"
+)
+
+// Image resizes the image to the width and height, averaging the source
+// pixels covered by each resulting pixel.
+func Image(img image.Image, width, height int) *image.NRGBA {
+	bounds := img.Bounds()
+	result := image.NewNRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		minY := bounds.Min.Y + y*bounds.Dy()/height
+		maxY := bounds.Min.Y + (y+1)*bounds.Dy()/height
+		if maxY <= minY {
+			maxY = minY + 1
+		}
+
+		for x := 0; x < width; x++ {
+			minX := bounds.Min.X + x*bounds.Dx()/width
+			maxX := bounds.Min.X + (x+1)*bounds.Dx()/width
+			if maxX <= minX {
+				maxX = minX + 1
+			}
+
+			var r, g, b, a, n uint64
+			for sy := minY; sy < maxY; sy++ {
+				for sx := minX; sx < maxX; sx++ {
+					pr, pg, pb, pa := img.At(sx, sy).RGBA()
+					r += uint64(pr)
+					g += uint64(pg)
+					b += uint64(pb)
+					a += uint64(pa)
+					n++
+				}
+			}
+
+			result.Set(x, y, color.RGBA64{
+				R: uint16(r / n),
+				G: uint16(g / n),
+				B: uint16(b / n),
+				A: uint16(a / n),
+			})
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,95 @@
+package ping
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/1lann/beacon/chat"
+	"github.com/1lann/beacon/protocol"
+	"github.com/1lann/beacon/versions"
+	"math"
+	"strconv"
+)
+
+// NBTComponentProtocol is the protocol number of 1.20.3, the first release
+// that encodes text components as NBT outside of the login state.
+const NBTComponentProtocol = 765
+
+// Disconnect disconnects a client using the protocol number with the
+// message, using the disconnect packet of the state of its connection. The
+// message is encoded as JSON in the login state, and as NBT in the
+// configuration state for clients from 1.20.3.
+func Disconnect(s protocol.Stream, message chat.Component, protocolNumber int,
+	state protocol.State) error {
+	packet, err := protocol.NewPacket(protocolNumber, state, "disconnect")
+	if err != nil {
+		return err
+	}
+	defer packet.Release()
+
+	message = message.ForProtocol(protocolNumber)
+
+	if state == protocol.StateConfiguration &&
+		versions.AtLeast(protocolNumber, NBTComponentProtocol) {
+		if err := writeNBTComponent(packet, message); err != nil {
+			return err
+		}
+
+		return s.WritePacket(packet)
+	}
+
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	packet.WriteString(string(data))
+	return s.WritePacket(packet)
+}
+
+// writeNBTComponent writes the text component as network NBT. The
+// component is converted from its JSON form, so that fields are named as
+// in JSON, and whole numbers (such as the count of an item shown by a hover
+// event) are written as TAG_Int rather than TAG_Double.
+func writeNBTComponent(p *protocol.Packet, component chat.Component) error {
+	data, err := json.Marshal(component)
+	if err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return err
+	}
+
+	return p.WriteNBT(nbtNumbers(value))
+}
+
+// nbtNumbers replaces the json.Numbers in a decoded JSON value with the
+// smallest of int32, int64 or float64 that holds them.
+func nbtNumbers(value interface{}) interface{} {
+	switch value := value.(type) {
+	case json.Number:
+		if number, err := strconv.ParseInt(string(value), 10, 64); err == nil {
+			if number >= math.MinInt32 && number <= math.MaxInt32 {
+				return int32(number)
+			}
+			return number
+		}
+
+		number, _ := value.Float64()
+		return number
+	case map[string]interface{}:
+		for key, element := range value {
+			value[key] = nbtNumbers(element)
+		}
+	case []interface{}:
+		for i, element := range value {
+			value[i] = nbtNumbers(element)
+		}
+	}
+
+	return value
+}
@@ -0,0 +1,146 @@
+package ping
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/1lann/beacon/chat"
+	"github.com/1lann/beacon/protocol"
+	"github.com/1lann/beacon/protocol/nbt"
+	"testing"
+)
+
+// disconnectMessage returns a message with a decoration, a child and a
+// hover event that shows an item, whose count is a number.
+func disconnectMessage() chat.Component {
+	bold := true
+	return chat.Component{
+		Text:  "Kicked",
+		Color: chat.ColorRed,
+		Bold:  &bold,
+		HoverEvent: &chat.HoverEvent{
+			Action: chat.HoverShowItem,
+			Contents: map[string]interface{}{
+				"id":    "minecraft:diamond",
+				"count": 64,
+				"scale": 1.5,
+			},
+		},
+		Extra: []chat.Component{chat.Text("!")},
+	}
+}
+
+// readDisconnect writes a disconnect packet and returns its ID and the
+// stream of its fields.
+func readDisconnect(t *testing.T, protocolNumber int,
+	state protocol.State) (int, protocol.PacketStream) {
+	var buf bytes.Buffer
+	if err := Disconnect(protocol.NewStream(&buf), disconnectMessage(),
+		protocolNumber, state); err != nil {
+		t.Fatal(err)
+	}
+
+	ps, _, err := protocol.NewStream(&buf).GetPacketStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := ps.ReadVarInt()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return id, ps
+}
+
+func TestDisconnectJSON(t *testing.T) {
+	tests := []struct {
+		protocolNumber int
+		state          protocol.State
+		id             int
+	}{
+		{47, protocol.StateLogin, 0x00},
+		{765, protocol.StateLogin, 0x00},
+		{773, protocol.StateTransfer, 0x00},
+		// Configuration disconnects were JSON in 1.20.2.
+		{764, protocol.StateConfiguration, 0x01},
+	}
+
+	for _, test := range tests {
+		id, ps := readDisconnect(t, test.protocolNumber, test.state)
+		if id != test.id {
+			t.Errorf("%d %s: packet ID = %#x, want %#x", test.protocolNumber,
+				test.state, id, test.id)
+		}
+
+		data, err := ps.ReadString()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var message chat.Component
+		if err := json.Unmarshal([]byte(data), &message); err != nil {
+			t.Errorf("%d %s: %v", test.protocolNumber, test.state, err)
+			continue
+		}
+
+		if message.Text != "Kicked" || message.Color != chat.ColorRed ||
+			len(message.Extra) != 1 {
+			t.Errorf("%d %s: message = %s", test.protocolNumber, test.state,
+				data)
+		}
+	}
+}
+
+func TestDisconnectNBT(t *testing.T) {
+	for protocolNumber, expectedID := range map[int]int{765: 0x01,
+		766: 0x02, 773: 0x02} {
+		id, ps := readDisconnect(t, protocolNumber, protocol.StateConfiguration)
+		if id != expectedID {
+			t.Errorf("%d: packet ID = %#x, want %#x", protocolNumber, id,
+				expectedID)
+		}
+
+		tag, err := nbt.ReadNetwork(ps)
+		if err != nil {
+			t.Fatalf("%d: %v", protocolNumber, err)
+		}
+
+		if remaining := ps.GetRemainingBytes(); remaining != 0 {
+			t.Errorf("%d: %d bytes left unread", protocolNumber, remaining)
+		}
+
+		message, ok := tag.(nbt.Compound)
+		if !ok {
+			t.Fatalf("%d: root is %s, want TAG_Compound", protocolNumber,
+				tag.Type())
+		}
+
+		hover, _ := message["hoverEvent"].(nbt.Compound)
+		contents, _ := hover["contents"].(nbt.Compound)
+		extra, _ := message["extra"].(nbt.List)
+
+		tests := []struct {
+			name string
+			tag  nbt.Tag
+			want nbt.Tag
+		}{
+			{"text", message["text"], nbt.String("Kicked")},
+			{"color", message["color"], nbt.String("red")},
+			{"bold", message["bold"], nbt.Byte(1)},
+			{"action", hover["action"], nbt.String("show_item")},
+			{"count", contents["count"], nbt.Int(64)},
+			{"scale", contents["scale"], nbt.Double(1.5)},
+		}
+
+		for _, test := range tests {
+			if test.tag != test.want {
+				t.Errorf("%d: %s = %#v, want %#v", protocolNumber, test.name,
+					test.tag, test.want)
+			}
+		}
+
+		if extra.ElementType != nbt.TagCompound || len(extra.Elements) != 1 {
+			t.Errorf("%d: extra = %+v", protocolNumber, extra)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package ping
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"github.com/1lann/beacon/internal/resize"
+	"image"
+	"image/png"
+	"io/ioutil"
+)
+
+// IconSize is the width and height of server icons in pixels.
+const IconSize = 64
+
+// Limits on the images accepted as server icons, to avoid spending
+// unreasonable amounts of memory or time decoding them.
+const (
+	MaxIconFileSize  = 4 << 20
+	MaxIconDimension = 4096
+)
+
+// Errors returned when setting the icon of a Status.
+var (
+	ErrIconNotPNG   = errors.New("ping: icon is not a PNG image")
+	ErrIconTooLarge = errors.New("ping: icon is too large")
+)
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// SetIcon sets the icon displayed next to the status on the server list
+// menu. The image is resized to IconSize x IconSize if necessary, and is
+// encoded once into the Favicon of the status.
+func (s *Status) SetIcon(img image.Image) error {
+	bounds := img.Bounds()
+	if bounds.Dx() > MaxIconDimension || bounds.Dy() > MaxIconDimension {
+		return ErrIconTooLarge
+	}
+
+	if bounds.Dx() <= 0 || bounds.Dy() <= 0 {
+		return errors.New("ping: icon is empty")
+	}
+
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, resizeIcon(img)); err != nil {
+		return err
+	}
+
+	s.Favicon = encodeIcon(buf.Bytes())
+	return nil
+}
+
+// SetIconPNG sets the icon of the status from PNG encoded data, see SetIcon.
+// Data that is already an IconSize x IconSize PNG image is used as is.
+func (s *Status) SetIconPNG(data []byte) error {
+	if len(data) > MaxIconFileSize {
+		return ErrIconTooLarge
+	}
+
+	if !bytes.HasPrefix(data, pngSignature) {
+		return ErrIconNotPNG
+	}
+
+	config, err := png.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return ErrIconNotPNG
+	}
+
+	if config.Width > MaxIconDimension || config.Height > MaxIconDimension {
+		return ErrIconTooLarge
+	}
+
+	if config.Width == IconSize && config.Height == IconSize {
+		s.Favicon = encodeIcon(data)
+		return nil
+	}
+
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return ErrIconNotPNG
+	}
+
+	return s.SetIcon(img)
+}
+
+// LoadIcon sets the icon of the status from the PNG file at path,
+// see SetIconPNG.
+func (s *Status) LoadIcon(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	return s.SetIconPNG(data)
+}
+
+func encodeIcon(data []byte) string {
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(data)
+}
+
+// resizeIcon resizes the image to IconSize x IconSize, averaging the source
+// pixels covered by each resulting pixel.
+func resizeIcon(img image.Image) image.Image {
+	bounds := img.Bounds()
+	if bounds.Dx() == IconSize && bounds.Dy() == IconSize {
+		return img
+	}
+
+	return resize.Image(img, IconSize, IconSize)
+}
@@ -0,0 +1,234 @@
+package ping
+
+import (
+	"github.com/1lann/beacon/chat"
+	"github.com/1lann/beacon/protocol"
+	"strconv"
+	"strings"
+)
+
+// Legacy (pre-1.7) packet IDs, which are sent as the first byte of the
+// connection instead of a VarInt framed packet.
+const (
+	LegacyPingID  = 0xFE
+	LegacyLoginID = 0x02
+	LegacyKickID  = 0xFF
+)
+
+// LegacyPingKind is the format of a legacy server list ping.
+type LegacyPingKind int
+
+// The formats of legacy server list pings.
+const (
+	// LegacyPingBeta is sent by beta 1.8 to 1.3 clients, and is responded
+	// to with only the message and player counts.
+	LegacyPingBeta LegacyPingKind = iota
+	// LegacyPing14 is sent by 1.4 and 1.5 clients.
+	LegacyPing14
+	// LegacyPing16 is sent by 1.6 clients, and also contains the protocol
+	// number and address the client is connecting to.
+	LegacyPing16
+)
+
+// legacyProtocolNumber is responded to legacy clients when their protocol
+// number is unknown, so that the version name is displayed.
+const legacyProtocolNumber = 127
+
+// LegacyPingPacket contains the decoded data from a legacy server list ping.
+// See ReadLegacyPingPacket.
+type LegacyPingPacket struct {
+	Kind LegacyPingKind
+	// ProtocolNumber, ServerAddress and ServerPort are only sent by
+	// 1.6 clients, and are otherwise left empty.
+	ProtocolNumber int
+	ServerAddress  string
+	ServerPort     int
+}
+
+// LegacyLoginPacket contains the decoded data from a legacy login handshake.
+// See ReadLegacyLoginPacket.
+type LegacyLoginPacket struct {
+	// ProtocolNumber is 0 for clients older than 1.3.
+	ProtocolNumber int
+	Username       string
+	// ServerAddress and ServerPort are empty for clients older than 1.0.
+	ServerAddress string
+	ServerPort    int
+}
+
+// isTimeout returns whether the error is caused by a read deadline, which
+// is used to detect clients that have finished sending their ping.
+func isTimeout(err error) bool {
+	timeout, ok := err.(interface {
+		Timeout() bool
+	})
+	return ok && timeout.Timeout()
+}
+
+// ReadLegacyPingPacket reads the rest of a legacy server list ping after its
+// 0xFE packet ID. Older clients do not send anything after the packet ID and
+// wait for a response, so the stream should have a read deadline set,
+// after which the ping is assumed to be complete.
+func ReadLegacyPingPacket(s protocol.Stream) (LegacyPingPacket, error) {
+	b, err := s.ReadByte()
+	if err != nil {
+		if isTimeout(err) {
+			return LegacyPingPacket{Kind: LegacyPingBeta}, nil
+		}
+		return LegacyPingPacket{}, err
+	}
+
+	if b != 0x01 {
+		return LegacyPingPacket{}, protocol.ErrInvalidData
+	}
+
+	b, err = s.ReadByte()
+	if err != nil {
+		if isTimeout(err) {
+			return LegacyPingPacket{Kind: LegacyPing14}, nil
+		}
+		return LegacyPingPacket{}, err
+	}
+
+	if b != 0xFA {
+		return LegacyPingPacket{}, protocol.ErrInvalidData
+	}
+
+	channel, err := s.ReadLegacyString()
+	if err != nil {
+		return LegacyPingPacket{}, err
+	}
+
+	if channel != "MC|PingHost" {
+		return LegacyPingPacket{}, protocol.ErrInvalidData
+	}
+
+	// Length of the remaining data, which is not needed.
+	if _, err = s.ReadUInt16(); err != nil {
+		return LegacyPingPacket{}, err
+	}
+
+	ping := LegacyPingPacket{Kind: LegacyPing16}
+	protocolNumber, err := s.ReadByte()
+	if err != nil {
+		return LegacyPingPacket{}, err
+	}
+
+	ping.ProtocolNumber = int(protocolNumber)
+
+	if ping.ServerAddress, err = s.ReadLegacyString(); err != nil {
+		return LegacyPingPacket{}, err
+	}
+
+	port, err := s.ReadInt32()
+	if err != nil {
+		return LegacyPingPacket{}, err
+	}
+
+	ping.ServerPort = int(port)
+	return ping, nil
+}
+
+// ReadLegacyLoginPacket reads the rest of a legacy login handshake after its
+// 0x02 packet ID.
+func ReadLegacyLoginPacket(s protocol.Stream) (LegacyLoginPacket, error) {
+	b, err := s.ReadByte()
+	if err != nil {
+		return LegacyLoginPacket{}, err
+	}
+
+	login := LegacyLoginPacket{}
+
+	if b == 0x00 {
+		// Clients older than 1.3 send "username;host:port" as a single
+		// legacy string, where b is the high byte of its length.
+		low, err := s.ReadByte()
+		if err != nil {
+			return LegacyLoginPacket{}, err
+		}
+
+		data := make([]byte, int(low)*2)
+		if err := s.ReadFull(data); err != nil {
+			return LegacyLoginPacket{}, err
+		}
+
+		text := protocol.DecodeUTF16BE(data)
+		login.Username = text
+		if i := strings.Index(text, ";"); i >= 0 {
+			login.Username = text[:i]
+			address := text[i+1:]
+			login.ServerAddress = address
+			if j := strings.LastIndex(address, ":"); j >= 0 {
+				login.ServerAddress = address[:j]
+				login.ServerPort, _ = strconv.Atoi(address[j+1:])
+			}
+		}
+
+		return login, nil
+	}
+
+	login.ProtocolNumber = int(b)
+
+	if login.Username, err = s.ReadLegacyString(); err != nil {
+		return LegacyLoginPacket{}, err
+	}
+
+	if login.ServerAddress, err = s.ReadLegacyString(); err != nil {
+		return LegacyLoginPacket{}, err
+	}
+
+	port, err := s.ReadInt32()
+	if err != nil {
+		return LegacyLoginPacket{}, err
+	}
+
+	login.ServerPort = int(port)
+	return login, nil
+}
+
+// WriteLegacyHandshakeResponse writes a response to a legacy server list
+// ping with the status, in the format expected by the kind of ping.
+func WriteLegacyHandshakeResponse(s protocol.Stream, status Status,
+	ping LegacyPingPacket) error {
+	message, err := status.legacyMessage()
+	if err != nil {
+		return err
+	}
+
+	var response string
+
+	if ping.Kind == LegacyPingBeta {
+		// Beta clients use § as the separator, so it can't be used
+		// for formatting.
+		response = chat.Plain(message) + "§" +
+			strconv.Itoa(status.OnlinePlayers) + "§" +
+			strconv.Itoa(status.MaxPlayers)
+	} else {
+		protocolNumber := legacyProtocolNumber
+		if status.EchoProtocol && ping.Kind == LegacyPing16 {
+			protocolNumber = ping.ProtocolNumber
+		}
+
+		response = strings.Join([]string{
+			"§1",
+			strconv.Itoa(protocolNumber),
+			status.legacyVersionName(),
+			chat.DownsampleLegacy(message),
+			strconv.Itoa(status.OnlinePlayers),
+			strconv.Itoa(status.MaxPlayers),
+		}, "\x00")
+	}
+
+	return DisplayLegacyMessage(s, response)
+}
+
+// DisplayLegacyMessage responds with a kick packet containing the message,
+// which legacy clients display as a disconnect message when they attempt
+// to connect to the server.
+func DisplayLegacyMessage(s protocol.Stream, message string) error {
+	responsePacket := &protocol.Packet{}
+	responsePacket.WriteByte(LegacyKickID)
+	responsePacket.WriteLegacyString(message)
+	_, err := s.Write(responsePacket.Data)
+	return err
+}
@@ -0,0 +1,234 @@
+package ping
+
+import (
+	"bytes"
+	"github.com/1lann/beacon/protocol"
+	"io"
+	"testing"
+)
+
+// timeoutError is returned by legacyConn when a read deadline is reached.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// legacyConn reads what the client sent, after which it returns a
+// timeoutError if timeout is set, like a connection with a read deadline,
+// or io.EOF otherwise.
+type legacyConn struct {
+	reader  *bytes.Reader
+	timeout bool
+	written bytes.Buffer
+}
+
+func (c *legacyConn) Read(data []byte) (int, error) {
+	n, err := c.reader.Read(data)
+	if err == io.EOF && c.timeout {
+		return n, timeoutError{}
+	}
+
+	return n, err
+}
+
+func (c *legacyConn) Write(data []byte) (int, error) {
+	return c.written.Write(data)
+}
+
+// legacyPacket returns the data written by write, as a client would send it.
+func legacyPacket(write func(p *protocol.Packet)) []byte {
+	p := &protocol.Packet{}
+	write(p)
+	return p.Data
+}
+
+// pingHost returns the rest of a 1.6 ping after its 0xFE packet ID.
+func pingHost(channel string, protocolNumber byte, address string,
+	port int32) []byte {
+	host := legacyPacket(func(p *protocol.Packet) {
+		p.WriteByte(protocolNumber)
+		p.WriteLegacyString(address)
+		p.WriteInt32(port)
+	})
+
+	return legacyPacket(func(p *protocol.Packet) {
+		p.WriteByte(0x01)
+		p.WriteByte(0xFA)
+		p.WriteLegacyString(channel)
+		p.WriteUInt16(uint16(len(host)))
+		p.Write(host)
+	})
+}
+
+func TestReadLegacyPingPacket(t *testing.T) {
+	ping16 := pingHost("MC|PingHost", 78, "mc.example.com", 25565)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		timeout bool
+		ping    LegacyPingPacket
+		err     bool
+	}{
+		{"beta", nil, true, LegacyPingPacket{Kind: LegacyPingBeta}, false},
+		{"1.4", []byte{0x01}, true, LegacyPingPacket{Kind: LegacyPing14}, false},
+		{"1.6", ping16, true, LegacyPingPacket{
+			Kind:           LegacyPing16,
+			ProtocolNumber: 78,
+			ServerAddress:  "mc.example.com",
+			ServerPort:     25565,
+		}, false},
+		{"1.6 without deadline", ping16, false, LegacyPingPacket{
+			Kind:           LegacyPing16,
+			ProtocolNumber: 78,
+			ServerAddress:  "mc.example.com",
+			ServerPort:     25565,
+		}, false},
+		// Without a deadline, a closed connection isn't a complete ping.
+		{"beta closed", nil, false, LegacyPingPacket{}, true},
+		{"1.4 closed", []byte{0x01}, false, LegacyPingPacket{}, true},
+		{"1.6 truncated", ping16[:len(ping16)-2], true,
+			LegacyPingPacket{}, true},
+		{"invalid", []byte{0x02}, true, LegacyPingPacket{}, true},
+		{"invalid 1.6", []byte{0x01, 0x00}, true, LegacyPingPacket{}, true},
+		{"invalid channel", pingHost("MC|Other", 78, "mc.example.com", 25565),
+			true, LegacyPingPacket{}, true},
+	}
+
+	for _, test := range tests {
+		conn := &legacyConn{reader: bytes.NewReader(test.data),
+			timeout: test.timeout}
+		ping, err := ReadLegacyPingPacket(protocol.NewStream(conn))
+		if (err != nil) != test.err {
+			t.Errorf("%s: error = %v, want error = %v", test.name, err,
+				test.err)
+		}
+
+		if ping != test.ping {
+			t.Errorf("%s: ping = %+v, want %+v", test.name, ping, test.ping)
+		}
+	}
+}
+
+func TestReadLegacyLoginPacket(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  []byte
+		login LegacyLoginPacket
+		err   bool
+	}{
+		{"1.3", legacyPacket(func(p *protocol.Packet) {
+			p.WriteByte(61)
+			p.WriteLegacyString("Notch")
+			p.WriteLegacyString("mc.example.com")
+			p.WriteInt32(25565)
+		}), LegacyLoginPacket{
+			ProtocolNumber: 61,
+			Username:       "Notch",
+			ServerAddress:  "mc.example.com",
+			ServerPort:     25565,
+		}, false},
+		{"1.0", legacyPacket(func(p *protocol.Packet) {
+			p.WriteLegacyString("Notch;mc.example.com:25565")
+		}), LegacyLoginPacket{
+			Username:      "Notch",
+			ServerAddress: "mc.example.com",
+			ServerPort:    25565,
+		}, false},
+		{"1.0 without port", legacyPacket(func(p *protocol.Packet) {
+			p.WriteLegacyString("Notch;mc.example.com")
+		}), LegacyLoginPacket{
+			Username:      "Notch",
+			ServerAddress: "mc.example.com",
+		}, false},
+		{"beta", legacyPacket(func(p *protocol.Packet) {
+			p.WriteLegacyString("Notch")
+		}), LegacyLoginPacket{Username: "Notch"}, false},
+		{"empty", nil, LegacyLoginPacket{}, true},
+		{"1.3 truncated", legacyPacket(func(p *protocol.Packet) {
+			p.WriteByte(61)
+			p.WriteLegacyString("Notch")
+		}), LegacyLoginPacket{}, true},
+		{"1.0 truncated", []byte{0x00, 0x05, 0x00, 'N'},
+			LegacyLoginPacket{}, true},
+	}
+
+	for _, test := range tests {
+		conn := &legacyConn{reader: bytes.NewReader(test.data)}
+		login, err := ReadLegacyLoginPacket(protocol.NewStream(conn))
+		if (err != nil) != test.err {
+			t.Errorf("%s: error = %v, want error = %v", test.name, err,
+				test.err)
+		}
+
+		if login != test.login {
+			t.Errorf("%s: login = %+v, want %+v", test.name, login,
+				test.login)
+		}
+	}
+}
+
+func TestDisplayLegacyMessage(t *testing.T) {
+	conn := &legacyConn{reader: bytes.NewReader(nil)}
+	if err := DisplayLegacyMessage(protocol.NewStream(conn),
+		"§1é😀"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The kick packet ID, the length in UTF-16 code units, and the message
+	// encoded as UTF-16BE, with the emoji as a surrogate pair.
+	expected := []byte{0xFF, 0x00, 0x05, 0x00, 0xA7, 0x00, '1', 0x00, 0xE9,
+		0xD8, 0x3D, 0xDE, 0x00}
+	if !bytes.Equal(conn.written.Bytes(), expected) {
+		t.Errorf("kick = % x, want % x", conn.written.Bytes(), expected)
+	}
+}
+
+func TestWriteLegacyHandshakeResponse(t *testing.T) {
+	status := Status{
+		OnlinePlayers: 3,
+		MaxPlayers:    20,
+		Message:       "§x§f§f§0§0§0§0red §lMOTD",
+		VersionName:   "beacon",
+		EchoProtocol:  true,
+	}
+
+	tests := []struct {
+		ping     LegacyPingPacket
+		response string
+	}{
+		// Beta clients can't display formatting.
+		{LegacyPingPacket{Kind: LegacyPingBeta}, "red MOTD§3§20"},
+		// Hex colors are downsampled, and the protocol number is only
+		// echoed to 1.6 clients, which send it.
+		{LegacyPingPacket{Kind: LegacyPing14},
+			"§1\x00127\x00beacon\x00§4red §lMOTD\x003\x0020"},
+		{LegacyPingPacket{Kind: LegacyPing16, ProtocolNumber: 78},
+			"§1\x0078\x00beacon\x00§4red §lMOTD\x003\x0020"},
+	}
+
+	for _, test := range tests {
+		conn := &legacyConn{reader: bytes.NewReader(nil)}
+		s := protocol.NewStream(conn)
+		if err := WriteLegacyHandshakeResponse(s, status, test.ping); err != nil {
+			t.Fatal(err)
+		}
+
+		conn.reader = bytes.NewReader(conn.written.Bytes())
+		if id, _ := s.ReadByte(); id != LegacyKickID {
+			t.Errorf("kind %d: packet ID = %#x, want %#x", test.ping.Kind, id,
+				LegacyKickID)
+		}
+
+		response, err := s.ReadLegacyString()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if response != test.response {
+			t.Errorf("kind %d: response = %q, want %q", test.ping.Kind,
+				response, test.response)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package ping
+
+import (
+	"github.com/1lann/beacon/protocol"
+	"github.com/1lann/beacon/versions"
+)
+
+// LoginStartPacket contains the decoded data from a login start packet.
+// See ReadLoginStartPacket.
+type LoginStartPacket struct {
+	Username string
+	// UUID is the UUID of the player sent by the client, which is always
+	// sent since 1.20.2, and optionally since 1.19.1. It's empty if the
+	// client didn't send one.
+	UUID string
+}
+
+// MaxUsername is the maximum length of a player's username.
+const MaxUsername = 16
+
+func init() {
+	protocol.SetDecoder(protocol.StateHandshaking, protocol.Serverbound,
+		"handshake", func(s protocol.Stream, _ int) (interface{}, error) {
+			return ReadHandshakePacket(s)
+		})
+
+	protocol.SetDecoder(protocol.StateLogin, protocol.Serverbound,
+		"login_start", func(s protocol.Stream,
+			protocolNumber int) (interface{}, error) {
+			return ReadLoginStartPacket(s, protocolNumber)
+		})
+}
+
+// ReadLoginStartPacket reads a login start packet (after its packet ID)
+// sent by a client using the protocol number, and decodes it.
+func ReadLoginStartPacket(s protocol.Stream,
+	protocolNumber int) (LoginStartPacket, error) {
+	login := LoginStartPacket{}
+	var err error
+	if login.Username, err = s.ReadStringMax(MaxUsername); err != nil {
+		return LoginStartPacket{}, &protocol.FieldError{
+			Field: "username",
+			Err:   err,
+		}
+	}
+
+	if !versions.AtLeast(protocolNumber, 764) {
+		if versions.AtLeast(protocolNumber, 759) &&
+			!versions.AtLeast(protocolNumber, 761) {
+			if err := skipSignatureData(s); err != nil {
+				return LoginStartPacket{}, err
+			}
+		}
+
+		if !versions.AtLeast(protocolNumber, 760) {
+			return login, nil
+		}
+
+		hasUUID, err := s.ReadBoolean()
+		if err != nil || !hasUUID {
+			return login, err
+		}
+	}
+
+	uuid, err := s.ReadUUID()
+	if err != nil {
+		return LoginStartPacket{}, err
+	}
+
+	login.UUID = uuid.String()
+	return login, nil
+}
+
+// skipSignatureData skips the optional chat signing key sent by 1.19 to
+// 1.19.2 clients in their login start packet, which isn't used.
+func skipSignatureData(s protocol.Stream) error {
+	hasSignature, err := s.ReadBoolean()
+	if err != nil || !hasSignature {
+		return err
+	}
+
+	if _, err := s.ReadInt64(); err != nil {
+		return err
+	}
+
+	if _, err := s.ReadByteArray(0); err != nil {
+		return err
+	}
+
+	_, err = s.ReadByteArray(0)
+	return err
+}
+
+// SetCompression sends a set compression packet to a client using the
+// protocol number in the login state, and enables compression of packets
+// of at least threshold bytes on the stream. A negative threshold disables
+// compression.
+func SetCompression(s *protocol.Stream, threshold int,
+	protocolNumber int) error {
+	packet, err := protocol.NewPacket(protocolNumber, protocol.StateLogin,
+		"set_compression")
+	if err != nil {
+		return err
+	}
+	defer packet.Release()
+
+	packet.WriteVarInt(threshold)
+	if err := s.WritePacket(packet); err != nil {
+		return err
+	}
+
+	s.SetCompression(threshold)
+	return nil
+}
@@ -0,0 +1,100 @@
+package ping
+
+import (
+	"github.com/1lann/beacon/protocol"
+	"strings"
+	"testing"
+)
+
+func TestReadLoginStartPacket(t *testing.T) {
+	const uuid = "069a79f4-44e9-4726-a5be-fca90e38aaf5"
+	parsed, err := protocol.ParseUUID(uuid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signature := func(p *protocol.Packet) {
+		p.WriteBoolean(true)
+		p.WriteInt64(1700000000000)
+		p.WriteByteArray([]byte("public key"))
+		p.WriteByteArray([]byte("signature"))
+	}
+
+	tests := []struct {
+		name           string
+		protocolNumber int
+		write          func(p *protocol.Packet)
+		uuid           string
+	}{
+		{"1.18.2", 758, nil, ""},
+		{"1.19 without signature", 759, func(p *protocol.Packet) {
+			p.WriteBoolean(false)
+		}, ""},
+		{"1.19 with signature", 759, signature, ""},
+		{"1.19.1 without UUID", 760, func(p *protocol.Packet) {
+			signature(p)
+			p.WriteBoolean(false)
+		}, ""},
+		{"1.19.1 with UUID", 760, func(p *protocol.Packet) {
+			p.WriteBoolean(false)
+			p.WriteBoolean(true)
+			p.WriteUUID(parsed)
+		}, uuid},
+		{"1.19.3 without UUID", 761, func(p *protocol.Packet) {
+			p.WriteBoolean(false)
+		}, ""},
+		{"1.19.3 with UUID", 761, func(p *protocol.Packet) {
+			p.WriteBoolean(true)
+			p.WriteUUID(parsed)
+		}, uuid},
+		{"1.20.2", 764, func(p *protocol.Packet) {
+			p.WriteUUID(parsed)
+		}, uuid},
+		{"1.21.9", 773, func(p *protocol.Packet) {
+			p.WriteUUID(parsed)
+		}, uuid},
+	}
+
+	for _, test := range tests {
+		p := protocol.NewPacketWithID(0)
+		p.WriteString("Notch")
+		if test.write != nil {
+			test.write(p)
+		}
+
+		ps := protocol.NewSliceStream(append([]byte(nil), p.Data[1:]...))
+		p.Release()
+
+		login, err := ReadLoginStartPacket(ps.Stream, test.protocolNumber)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		if login.Username != "Notch" || login.UUID != test.uuid {
+			t.Errorf("%s: login = %+v, want UUID %q", test.name, login,
+				test.uuid)
+		}
+
+		if remaining := ps.GetRemainingBytes(); remaining != 0 {
+			t.Errorf("%s: %d bytes left unread", test.name, remaining)
+		}
+	}
+
+	p := protocol.NewPacketWithID(0)
+	defer p.Release()
+	p.WriteString(strings.Repeat("a", MaxUsername+1))
+	ps := protocol.NewSliceStream(append([]byte(nil), p.Data[1:]...))
+	if _, err := ReadLoginStartPacket(ps.Stream, 764); err == nil {
+		t.Error("long username: expected an error")
+	}
+
+	// A 1.20.2 login start without the UUID is truncated.
+	p = protocol.NewPacketWithID(0)
+	defer p.Release()
+	p.WriteString("Notch")
+	ps = protocol.NewSliceStream(append([]byte(nil), p.Data[1:]...))
+	if _, err := ReadLoginStartPacket(ps.Stream, 764); err == nil {
+		t.Error("missing UUID: expected an error")
+	}
+}
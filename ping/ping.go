@@ -1,17 +1,23 @@
 // Package ping is used for reading and sending data regarding
 // handshaking, pinging and connecting.
-// It follows the Minecraft protocol version 5.
+// It supports the legacy server list pings of clients before 1.7, and the
+// packets of every later version in the versions package, whose IDs are
+// looked up in the protocol registry.
 package ping
 
 import (
 	"encoding/json"
+	"fmt"
+	"github.com/1lann/beacon/chat"
 	"github.com/1lann/beacon/protocol"
+	"github.com/1lann/beacon/versions"
 )
 
 type statusResponse struct {
-	Version     version `json:"version"`
-	Players     players `json:"players"`
-	Description string  `json:"description"`
+	Version     version        `json:"version"`
+	Players     players        `json:"players"`
+	Description chat.Component `json:"description"`
+	Favicon     string         `json:"favicon,omitempty"`
 }
 
 type version struct {
@@ -20,88 +26,223 @@ type version struct {
 }
 
 type players struct {
-	Max    int `json:"max"`
-	Online int `json:"online"`
-}
-
-type releaseName struct {
-	protocol int
-	name     string
-}
-
-var releaseNames = []releaseName{
-	{4, "1.7.5"},
-	{5, "1.7.10"},
-	{47, "1.8.9"},
-	{107, "1.9"},
+	Max    int            `json:"max"`
+	Online int            `json:"online"`
+	Sample []PlayerSample `json:"sample,omitempty"`
 }
 
 // HandshakePacket contains the decoded data from a handshake packet.
 // See ReadHandshakePacket.
 type HandshakePacket struct {
-	ProtocolNumber int
-	ServerAddress  string
-	ServerPort     uint16
-	NextState      int
+	ProtocolNumber int    `mc:"varint"`
+	ServerAddress  string `mc:"string,max=255"`
+	ServerPort     uint16 `mc:"ushort"`
+	NextState      int    `mc:"varint"`
 }
 
 // Status is the container for the information to respond with
 // on the Minecraft server list menu.
 type Status struct {
-	OnlinePlayers  int
-	MaxPlayers     int
-	Message        string
+	OnlinePlayers int
+	MaxPlayers    int
+	// Message is the message shown on the server list menu, either as a
+	// string formatted with legacy § codes or as a chat.Component. Other
+	// types are rejected with an error when the status is written.
+	Message        interface{}
 	ShowConnection bool
 	// ProtocolNumber is the internal protocol version number to respond with
 	// that can be found at http://wiki.vg/Protocol_version_numbers
 	ProtocolNumber int
+	// EchoProtocol responds with the client's own protocol number, so that
+	// every client sees the server as compatible.
+	EchoProtocol bool
+	// MinProtocol and MaxProtocol set the range of protocol numbers that are
+	// advertised as supported. Clients within the range are echoed their own
+	// protocol number, while clients outside of it are shown
+	// IncompatibleName. A zero value leaves that side of the range open.
+	// The range is ignored if both are zero.
+	MinProtocol int
+	MaxProtocol int
+	// VersionName replaces the version name of "1lann/beacon <release>"
+	// shown to clients, if it is not empty.
+	VersionName string
+	// IncompatibleName is the version name shown to clients outside of
+	// the range set by MinProtocol and MaxProtocol. VersionName is used
+	// if it is empty.
+	IncompatibleName string
+	// Sample is the list of players (or lines of information) shown when
+	// hovering over the player count. See SampleLines.
+	Sample []PlayerSample
+	// Favicon is the server icon encoded as a data URI, set by SetIcon,
+	// SetIconPNG or LoadIcon.
+	Favicon string
+}
+
+// ReadHandshakePacket reads a handshake packet (after its packet ID) and
+// decodes it.
+func ReadHandshakePacket(s protocol.Stream) (HandshakePacket, error) {
+	handshake := HandshakePacket{}
+	if err := protocol.Unmarshal(s, &handshake); err != nil {
+		return HandshakePacket{}, err
+	}
+
+	return handshake, nil
+}
+
+// inRange returns whether the protocol number is within the range set by
+// MinProtocol and MaxProtocol.
+func (s Status) inRange(protocolNumber int) bool {
+	if s.MinProtocol == 0 && s.MaxProtocol == 0 {
+		return false
+	}
+
+	if s.MinProtocol != 0 && !versions.AtLeast(protocolNumber, s.MinProtocol) {
+		return false
+	}
+
+	if s.MaxProtocol != 0 && protocolNumber != s.MaxProtocol &&
+		versions.AtLeast(protocolNumber, s.MaxProtocol) {
+		return false
+	}
+
+	return true
+}
+
+// versionName returns the version name shown to clients within the
+// supported range.
+func (s Status) versionName() string {
+	if s.VersionName != "" {
+		return s.VersionName
+	}
+
+	return "1lann/beacon " + versions.Name(s.ProtocolNumber)
+}
+
+// legacyVersionName returns the version name shown to legacy clients,
+// which are never within the supported range.
+func (s Status) legacyVersionName() string {
+	if (s.MinProtocol != 0 || s.MaxProtocol != 0) && s.IncompatibleName != "" {
+		return s.IncompatibleName
+	}
+
+	return s.versionName()
 }
 
-// getReleaseName returns the release name for a protocol version number.
-func getReleaseName(protocolNumber int) string {
-	for _, release := range releaseNames {
-		if protocolNumber <= release.protocol {
-			return release.name
+// messageComponent returns the Message as a text component. An error is
+// returned if the Message isn't a string or chat.Component, and a nil
+// Message is empty.
+func (s Status) messageComponent() (chat.Component, error) {
+	switch message := s.Message.(type) {
+	case nil:
+		return chat.Text(""), nil
+	case chat.Component:
+		return message, nil
+	case *chat.Component:
+		if message == nil {
+			return chat.Text(""), nil
 		}
+		return *message, nil
+	case string:
+		return chat.FromLegacy(message), nil
 	}
 
-	return "future"
+	return chat.Component{}, fmt.Errorf("ping: unsupported Message type %T",
+		s.Message)
 }
 
-// ReadHandshakePacket reads a handshake packet (packet ID 0) and decodes it.
-func ReadHandshakePacket(s protocol.Stream) (HandshakePacket, error) {
-	handshake := HandshakePacket{}
-	var err error
-	if handshake.ProtocolNumber, err = s.ReadVarInt(); err != nil {
-		return HandshakePacket{}, err
+// legacyMessage returns the Message as a string formatted with legacy
+// § codes, for clients that don't support text components.
+func (s Status) legacyMessage() (string, error) {
+	if message, ok := s.Message.(string); ok {
+		return message, nil
 	}
 
-	if handshake.ServerAddress, err = s.ReadString(); err != nil {
-		return HandshakePacket{}, err
+	message, err := s.messageComponent()
+	if err != nil {
+		return "", err
 	}
 
-	if handshake.ServerPort, err = s.ReadUInt16(); err != nil {
-		return HandshakePacket{}, err
+	return message.ToLegacy(), nil
+}
+
+// versionFor returns the version to respond with to a client using the
+// given protocol number.
+func (s Status) versionFor(clientProtocol int) version {
+	name := s.versionName()
+
+	if s.EchoProtocol {
+		return version{Name: name, Protocol: clientProtocol}
+	}
+
+	if s.MinProtocol == 0 && s.MaxProtocol == 0 {
+		return version{Name: name, Protocol: s.ProtocolNumber}
+	}
+
+	if s.inRange(clientProtocol) {
+		return version{Name: name, Protocol: clientProtocol}
+	}
+
+	if s.IncompatibleName != "" {
+		name = s.IncompatibleName
+	}
+
+	// The client must not see its own protocol number, otherwise it would
+	// consider itself compatible.
+	protocolNumber := s.ProtocolNumber
+	if protocolNumber == clientProtocol {
+		protocolNumber = -1
 	}
 
-	handshake.NextState, err = s.ReadVarInt()
-	return handshake, err
+	return version{Name: name, Protocol: protocolNumber}
+}
+
+// downsampleSample returns the player sample with hex colors downsampled.
+// Sample names are legacy formatted strings rather than components, so even
+// clients that support hex colors don't read the §x§R§R§G§G§B§B form in
+// them, and would show the color of its last digit instead.
+func downsampleSample(sample []PlayerSample) []PlayerSample {
+	if sample == nil {
+		return nil
+	}
+
+	result := make([]PlayerSample, len(sample))
+	for i, entry := range sample {
+		result[i] = PlayerSample{
+			Name: chat.DownsampleLegacy(entry.Name),
+			ID:   entry.ID,
+		}
+	}
+
+	return result
 }
 
 // WriteHandshakeResponse writes a response with a status that will be
-// displayed on the requesting player's server list menu.
+// displayed on the requesting player's server list menu. The status is
+// written as if the client uses status.ProtocolNumber, see
+// WriteStatusResponse to respond to a specific client.
 func WriteHandshakeResponse(s protocol.Stream, status Status) error {
+	return WriteStatusResponse(s, status, status.ProtocolNumber)
+}
+
+// WriteStatusResponse writes a response with a status that will be
+// displayed on the requesting player's server list menu, for a client
+// that sent the given protocol number in its handshake.
+func WriteStatusResponse(s protocol.Stream, status Status,
+	clientProtocol int) error {
+	message, err := status.messageComponent()
+	if err != nil {
+		return err
+	}
+
 	statusResponse := statusResponse{
-		Version: version{
-			Name: "1lann/beacon " +
-				getReleaseName(status.ProtocolNumber),
-			Protocol: status.ProtocolNumber,
-		},
+		Version: status.versionFor(clientProtocol),
 		Players: players{
 			Max:    status.MaxPlayers,
 			Online: status.OnlinePlayers,
+			Sample: downsampleSample(status.Sample),
 		},
-		Description: status.Message,
+		Description: message.ForProtocol(clientProtocol),
+		Favicon:     status.Favicon,
 	}
 
 	data, err := json.Marshal(statusResponse)
@@ -110,9 +251,9 @@ func WriteHandshakeResponse(s protocol.Stream, status Status) error {
 	}
 
 	responsePacket := protocol.NewPacketWithID(0x00)
+	defer responsePacket.Release()
 	responsePacket.WriteString(string(data))
-	err = s.WritePacket(responsePacket)
-	return err
+	return s.WritePacket(responsePacket)
 }
 
 // HandlePingPacket handles a ping packet used by the Minecraft client
@@ -128,15 +269,17 @@ func HandlePingPacket(s protocol.Stream, status Status) error {
 		return err
 	}
 	responsePacket := protocol.NewPacketWithID(0x01)
+	defer responsePacket.Release()
 	responsePacket.WriteInt64(time)
-	err = s.WritePacket(responsePacket)
-	return err
+	return s.WritePacket(responsePacket)
 }
 
 // DisplayMessage responds with a disconnect message to the player
-// when they attempt to connect to the server.
+// when they attempt to connect to the server, in the login state.
+// See Disconnect for other states.
 func DisplayMessage(s protocol.Stream, message string) error {
 	responsePacket := protocol.NewPacketWithID(0x00)
+	defer responsePacket.Release()
 
 	chatMessage := message
 
@@ -149,3 +292,18 @@ func DisplayMessage(s protocol.Stream, message string) error {
 	err = s.WritePacket(responsePacket)
 	return err
 }
+
+// DisplayComponent responds with a disconnect message in the form of a text
+// component to the player when they attempt to connect to the server, in
+// the login state. See Disconnect for other states.
+func DisplayComponent(s protocol.Stream, message chat.Component) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	responsePacket := protocol.NewPacketWithID(0x00)
+	defer responsePacket.Release()
+	responsePacket.WriteString(string(data))
+	return s.WritePacket(responsePacket)
+}
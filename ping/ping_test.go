@@ -0,0 +1,183 @@
+package ping
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/1lann/beacon/chat"
+	"github.com/1lann/beacon/protocol"
+	"io"
+	"testing"
+)
+
+// clientConn reads what the client sent, and discards what's written to
+// it. It only implements io.ReadWriter, like a net.Conn.
+type clientConn struct {
+	reader *bytes.Reader
+}
+
+func (c clientConn) Read(data []byte) (int, error) {
+	return c.reader.Read(data)
+}
+
+func (c clientConn) Write(data []byte) (int, error) {
+	return len(data), nil
+}
+
+// statusPing returns the packets sent by a client to ping a server: a
+// handshake, status request and ping.
+func statusPing(b *testing.B) []byte {
+	var buf bytes.Buffer
+	s := protocol.NewStream(&buf)
+
+	handshake := protocol.NewPacketWithID(0x00)
+	err := protocol.Marshal(handshake, HandshakePacket{
+		ProtocolNumber: 767,
+		ServerAddress:  "play.example.com",
+		ServerPort:     25565,
+		NextState:      1,
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	ping := protocol.NewPacketWithID(0x01)
+	ping.WriteInt64(1234567890)
+
+	for _, p := range []*protocol.Packet{handshake,
+		protocol.NewPacketWithID(0x00), ping} {
+		if err := s.WritePacket(p); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	return buf.Bytes()
+}
+
+// nextPacket reads the next packet and its ID from the stream.
+func nextPacket(b *testing.B, s protocol.Stream) protocol.PacketStream {
+	ps, _, err := s.GetPacketStream()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	if _, err := ps.ReadVarInt(); err != nil {
+		b.Fatal(err)
+	}
+
+	return ps
+}
+
+// BenchmarkStatusPing reads a handshake, status request and ping from a
+// client, and responds with a status and pong, as the handler does.
+func BenchmarkStatusPing(b *testing.B) {
+	input := statusPing(b)
+	conn := clientConn{bytes.NewReader(input)}
+	status := Status{
+		OnlinePlayers:  5,
+		MaxPlayers:     20,
+		Message:        "§aA Minecraft server",
+		ShowConnection: true,
+		ProtocolNumber: 767,
+		Sample:         SampleLines("§eWelcome!"),
+	}
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(input)))
+	for i := 0; i < b.N; i++ {
+		conn.reader.Reset(input)
+		s := protocol.NewBufferedStream(conn)
+
+		handshake, err := ReadHandshakePacket(nextPacket(b, s).Stream)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		err = WriteStatusResponse(nextPacket(b, s).Stream, status,
+			handshake.ProtocolNumber)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		if err := HandlePingPacket(nextPacket(b, s).Stream, status); err != nil {
+			b.Fatal(err)
+		}
+
+		if _, _, err := s.GetPacketStream(); err != io.EOF {
+			b.Fatalf("expected io.EOF, got %v", err)
+		}
+
+		s.Release()
+	}
+}
+
+func TestStatusSampleDownsampled(t *testing.T) {
+	status := Status{
+		ProtocolNumber: 767,
+		Sample:         SampleLines("§x§f§f§5§5§5§5hex §aname"),
+	}
+
+	// Hex colors are downsampled even for clients that support them in
+	// components.
+	for _, clientProtocol := range []int{47, 735, 767} {
+		var buf bytes.Buffer
+		s := protocol.NewStream(&buf)
+		if err := WriteStatusResponse(s, status, clientProtocol); err != nil {
+			t.Fatal(err)
+		}
+
+		ps, _, err := s.GetPacketStream()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ps.ReadVarInt()
+
+		data, err := ps.ReadString()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var response statusResponse
+		if err := json.Unmarshal([]byte(data), &response); err != nil {
+			t.Fatal(err)
+		}
+
+		if name := response.Players.Sample[0].Name; name != "§chex §aname" {
+			t.Errorf("protocol %d: sample name = %q, want %q", clientProtocol,
+				name, "§chex §aname")
+		}
+	}
+}
+
+func TestStatusMessageTypes(t *testing.T) {
+	component := chat.Text("component")
+	tests := []struct {
+		message interface{}
+		valid   bool
+	}{
+		{nil, true},
+		{"§aMOTD", true},
+		{component, true},
+		{&component, true},
+		{(*chat.Component)(nil), true},
+		{[]byte("MOTD"), false},
+		{new(string), false},
+		{42, false},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		status := Status{Message: test.message}
+		err := WriteStatusResponse(protocol.NewStream(&buf), status, 767)
+		if (err == nil) != test.valid {
+			t.Errorf("Message %T: error = %v, want valid = %v", test.message,
+				err, test.valid)
+		}
+
+		err = WriteLegacyHandshakeResponse(protocol.NewStream(&buf), status,
+			LegacyPingPacket{Kind: LegacyPing16})
+		if (err == nil) != test.valid {
+			t.Errorf("Message %T: legacy error = %v, want valid = %v",
+				test.message, err, test.valid)
+		}
+	}
+}
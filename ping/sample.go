@@ -0,0 +1,50 @@
+package ping
+
+import (
+	"crypto/md5"
+	"fmt"
+)
+
+// PlayerSample is an entry in the list of players shown when hovering over
+// the player count on the server list menu. The entries don't have to be
+// real players, and are often used to show lines of extra information.
+type PlayerSample struct {
+	Name string `json:"name"`
+	ID   string `json:"id"`
+}
+
+// NewPlayerSample returns a PlayerSample for an informational line, with
+// a fake UUID that is derived from the line, so it stays the same between
+// pings.
+func NewPlayerSample(line string) PlayerSample {
+	return PlayerSample{
+		Name: line,
+		ID:   nameUUID("beacon:" + line),
+	}
+}
+
+// SampleLines returns a PlayerSample for each of the informational lines.
+// See NewPlayerSample.
+func SampleLines(lines ...string) []PlayerSample {
+	sample := make([]PlayerSample, len(lines))
+	for i, line := range lines {
+		sample[i] = NewPlayerSample(line)
+	}
+
+	return sample
+}
+
+// OfflineUUID returns the UUID a server in offline mode would assign to
+// a player with the given username.
+func OfflineUUID(username string) string {
+	return nameUUID("OfflinePlayer:" + username)
+}
+
+// nameUUID returns a version 3 (name based) UUID for the name.
+func nameUUID(name string) string {
+	sum := md5.Sum([]byte(name))
+	sum[6] = sum[6]&0x0F | 0x30
+	sum[8] = sum[8]&0x3F | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8],
+		sum[8:10], sum[10:16])
+}
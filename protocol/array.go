@@ -0,0 +1,73 @@
+package protocol
+
+import (
+	"fmt"
+)
+
+// ReadArray reads an array prefixed with its length as a VarInt from the
+// stream, reading each element with read. A max greater than zero limits
+// the length of the array. The array is grown as elements are read, so a
+// large length can't allocate more than the packet holds.
+func ReadArray[T any](s Stream, max int, read func(s Stream) (T, error)) ([]T,
+	error) {
+	length, err := s.ReadVarInt()
+	if err != nil {
+		return nil, err
+	}
+
+	if length < 0 || (max > 0 && length > max) {
+		return nil, fmt.Errorf("protocol: invalid array length %d", length)
+	}
+
+	capacity := length
+	if capacity > 64 {
+		capacity = 64
+	}
+
+	values := make([]T, 0, capacity)
+	for i := 0; i < length; i++ {
+		value, err := read(s)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+
+	return values, nil
+}
+
+// WriteArray writes an array prefixed with its length as a VarInt to the
+// Packet, writing each element with write.
+func WriteArray[T any](p *Packet, values []T, write func(p *Packet, value T)) {
+	p.WriteVarInt(len(values))
+	for _, value := range values {
+		write(p, value)
+	}
+}
+
+// ReadOptional reads a value prefixed with a boolean of whether it's
+// present from the stream, reading the value with read. nil is returned if
+// the value isn't present.
+func ReadOptional[T any](s Stream, read func(s Stream) (T, error)) (*T,
+	error) {
+	present, err := s.ReadBoolean()
+	if err != nil || !present {
+		return nil, err
+	}
+
+	value, err := read(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return &value, nil
+}
+
+// WriteOptional writes a value prefixed with a boolean of whether it's
+// present to the Packet, writing the value with write if it isn't nil.
+func WriteOptional[T any](p *Packet, value *T, write func(p *Packet, value T)) {
+	p.WriteBoolean(value != nil)
+	if value != nil {
+		write(p, *value)
+	}
+}
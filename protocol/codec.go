@@ -0,0 +1,599 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// DefaultMaxString is the maximum length of a string in characters, used
+// for string fields that don't set their own with the max option.
+const DefaultMaxString = 32767
+
+// A Marshaler writes itself to a packet, for types that can't be described
+// by struct tags.
+type Marshaler interface {
+	MarshalPacket(p *Packet) error
+}
+
+// An Unmarshaler reads itself from a stream, and is the counterpart of
+// Marshaler.
+type Unmarshaler interface {
+	UnmarshalPacket(s Stream) error
+}
+
+var (
+	marshalerType   = reflect.TypeOf((*Marshaler)(nil)).Elem()
+	unmarshalerType = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+)
+
+// fieldCodec describes how a struct field is encoded, from its "mc" struct
+// tag.
+type fieldCodec struct {
+	name     string
+	index    int
+	kind     string
+	max      int
+	optional bool
+	rest     bool
+}
+
+var codecCache sync.Map
+
+// structCodecs returns the codecs of the encoded fields of the struct type.
+func structCodecs(t reflect.Type) ([]fieldCodec, error) {
+	if codecs, found := codecCache.Load(t); found {
+		return codecs.([]fieldCodec), nil
+	}
+
+	var codecs []fieldCodec
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("mc")
+		if tag == "-" || field.PkgPath != "" {
+			continue
+		}
+
+		options := strings.Split(tag, ",")
+		codec := fieldCodec{
+			name:  t.Name() + "." + field.Name,
+			index: i,
+			kind:  options[0],
+		}
+
+		for _, option := range options[1:] {
+			switch {
+			case option == "optional":
+				codec.optional = true
+			case option == "rest":
+				codec.rest = true
+			case strings.HasPrefix(option, "max="):
+				max, err := strconv.Atoi(strings.TrimPrefix(option, "max="))
+				if err != nil || max < 0 {
+					return nil, fmt.Errorf("protocol: %s: invalid option %q",
+						codec.name, option)
+				}
+				codec.max = max
+			default:
+				return nil, fmt.Errorf("protocol: %s: unknown option %q",
+					codec.name, option)
+			}
+		}
+
+		if codec.optional && field.Type.Kind() != reflect.Ptr {
+			return nil, fmt.Errorf("protocol: %s: optional field must be a "+
+				"pointer", codec.name)
+		}
+
+		if codec.rest && (field.Type.Kind() != reflect.Slice ||
+			field.Type.Elem().Kind() != reflect.Uint8) {
+			return nil, fmt.Errorf("protocol: %s: rest field must be a "+
+				"byte slice", codec.name)
+		}
+
+		if !kindAllowed(codec.kind, field.Type) {
+			return nil, fmt.Errorf("protocol: %s: %s can't be encoded as %q",
+				codec.name, field.Type, codec.kind)
+		}
+
+		codecs = append(codecs, codec)
+	}
+
+	codecCache.Store(t, codecs)
+	return codecs, nil
+}
+
+// kindAllowed returns whether values of the type can be encoded as the
+// kind given in a struct tag. For slices and arrays, the kind applies to
+// their elements, except for nbt and json, which encode the whole value.
+func kindAllowed(kind string, t reflect.Type) bool {
+	switch kind {
+	case "", "nbt", "json":
+		return true
+	}
+
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice ||
+		t.Kind() == reflect.Array {
+		t = t.Elem()
+	}
+
+	switch kind {
+	case "varint", "varlong", "byte", "ubyte", "short", "ushort", "int",
+		"long":
+		switch t.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+			reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16,
+			reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			return true
+		}
+	case "bool":
+		return t.Kind() == reflect.Bool
+	case "float", "double":
+		return t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64
+	case "string":
+		return t.Kind() == reflect.String
+	}
+
+	return false
+}
+
+// inferKind returns the kind of encoding used for values of the Go kind
+// when a field doesn't specify one.
+func inferKind(kind reflect.Kind) string {
+	switch kind {
+	case reflect.Bool:
+		return "bool"
+	case reflect.Int8:
+		return "byte"
+	case reflect.Uint8:
+		return "ubyte"
+	case reflect.Int16:
+		return "short"
+	case reflect.Uint16:
+		return "ushort"
+	case reflect.Int32, reflect.Uint32:
+		return "int"
+	case reflect.Int64, reflect.Uint64:
+		return "long"
+	case reflect.Int, reflect.Uint:
+		return "varint"
+	case reflect.Float32:
+		return "float"
+	case reflect.Float64:
+		return "double"
+	case reflect.String:
+		return "string"
+	}
+
+	return ""
+}
+
+// Marshal writes the fields of the struct v, or the struct pointed to by v,
+// to the packet in order. Fields are encoded according to their "mc" struct
+// tag, which starts with the type they're encoded as:
+//
+//	varint, varlong     VarInts of an integer field
+//	bool                a boolean
+//	byte, ubyte         a signed or unsigned byte
+//	short, ushort       a signed or unsigned short
+//	int, long           a 4 or 8 byte integer
+//	float, double       a single or double-precision float
+//	string              a string prefixed with its length as a VarInt
+//	nbt                 network NBT, using the nbt package
+//	json                a string of the value encoded as JSON
+//
+// If the type is omitted, it's inferred from the Go type of the field, with
+// int and uint fields encoded as VarInts. For slices, the type applies to
+// their elements, and the slice is prefixed with its length as a VarInt.
+// Arrays are encoded without a length. Nested structs are encoded in place,
+// and fields whose type implements Marshaler encode themselves. The nbt
+// and json types always encode the whole field, whatever its Go type.
+// A type that doesn't match the Go type of the field is an error.
+//
+// The type may be followed by options, separated by commas:
+//
+//	max=N      the maximum length of a string or json in characters, or of
+//	           a slice
+//	optional   the pointer field is prefixed with a boolean, and is nil if
+//	           false
+//	rest       the byte slice isn't prefixed, and takes up the rest of
+//	           the packet
+//
+// Fields tagged with "-" are skipped.
+func Marshal(p *Packet, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("protocol: can't marshal %T", v)
+	}
+
+	return marshalStruct(p, rv)
+}
+
+// Unmarshal reads the fields of the struct pointed to by v from the stream
+// in order, using the same encoding as Marshal.
+func Unmarshal(s Stream, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() ||
+		rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("protocol: can't unmarshal into %T", v)
+	}
+
+	return unmarshalStruct(s, rv.Elem())
+}
+
+func marshalStruct(p *Packet, v reflect.Value) error {
+	codecs, err := structCodecs(v.Type())
+	if err != nil {
+		return err
+	}
+
+	for _, codec := range codecs {
+		if err := marshalValue(p, v.Field(codec.index), codec); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func marshalValue(p *Packet, v reflect.Value, codec fieldCodec) error {
+	if v.Kind() == reflect.Ptr {
+		if codec.optional {
+			p.WriteBoolean(!v.IsNil())
+			if v.IsNil() {
+				return nil
+			}
+			codec.optional = false
+		} else if v.IsNil() {
+			return fmt.Errorf("protocol: %s: nil pointer", codec.name)
+		}
+
+		return marshalValue(p, v.Elem(), codec)
+	}
+
+	switch codec.kind {
+	case "nbt":
+		return p.WriteNBT(v.Interface())
+	case "json":
+		data, err := json.Marshal(v.Interface())
+		if err != nil {
+			return err
+		}
+
+		return marshalString(p, string(data), codec)
+	}
+
+	if v.Type().Implements(marshalerType) {
+		return v.Interface().(Marshaler).MarshalPacket(p)
+	}
+
+	if v.CanAddr() && v.Addr().Type().Implements(marshalerType) {
+		return v.Addr().Interface().(Marshaler).MarshalPacket(p)
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		return marshalStruct(p, v)
+	case reflect.Slice:
+		if codec.max > 0 && v.Len() > codec.max {
+			return fmt.Errorf("protocol: %s: length %d exceeds %d",
+				codec.name, v.Len(), codec.max)
+		}
+
+		if !codec.rest {
+			p.WriteVarInt(v.Len())
+		}
+		fallthrough
+	case reflect.Array:
+		if codec.kind == "" && v.Type().Elem().Kind() == reflect.Uint8 {
+			for i := 0; i < v.Len(); i++ {
+				p.WriteByte(byte(v.Index(i).Uint()))
+			}
+			return nil
+		}
+
+		element := codec
+		element.max = 0
+		for i := 0; i < v.Len(); i++ {
+			if err := marshalValue(p, v.Index(i), element); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	kind := codec.kind
+	if kind == "" {
+		kind = inferKind(v.Kind())
+	}
+
+	switch kind {
+	case "varint":
+		p.WriteVarInt(int(intValue(v)))
+	case "varlong":
+		p.WriteVarInt64(intValue(v))
+	case "bool":
+		p.WriteBoolean(v.Bool())
+	case "byte", "ubyte":
+		p.WriteByte(byte(intValue(v)))
+	case "short", "ushort":
+		p.WriteUInt16(uint16(intValue(v)))
+	case "int":
+		p.WriteInt32(int32(intValue(v)))
+	case "long":
+		p.WriteInt64(intValue(v))
+	case "float":
+		p.WriteFloat32(float32(v.Float()))
+	case "double":
+		p.WriteFloat64(v.Float())
+	case "string":
+		return marshalString(p, v.String(), codec)
+	default:
+		return fmt.Errorf("protocol: %s: can't marshal %s", codec.name,
+			v.Type())
+	}
+
+	return nil
+}
+
+// marshalString writes a string, checking its length against the max
+// option of the field.
+func marshalString(p *Packet, value string, codec fieldCodec) error {
+	if utf8.RuneCountInString(value) > maxString(codec) {
+		return fieldError(codec.name, ErrStringTooLong)
+	}
+
+	p.WriteString(value)
+	return nil
+}
+
+// maxString returns the maximum length of a string field in characters.
+func maxString(codec fieldCodec) int {
+	if codec.max == 0 {
+		return DefaultMaxString
+	}
+
+	return codec.max
+}
+
+func unmarshalStruct(s Stream, v reflect.Value) error {
+	codecs, err := structCodecs(v.Type())
+	if err != nil {
+		return err
+	}
+
+	for _, codec := range codecs {
+		if err := unmarshalValue(s, v.Field(codec.index), codec); err != nil {
+			return fieldError(codec.name, err)
+		}
+	}
+
+	return nil
+}
+
+func unmarshalValue(s Stream, v reflect.Value, codec fieldCodec) error {
+	if v.Kind() == reflect.Ptr {
+		if codec.optional {
+			present, err := s.ReadBoolean()
+			if err != nil {
+				return err
+			}
+
+			if !present {
+				v.Set(reflect.Zero(v.Type()))
+				return nil
+			}
+			codec.optional = false
+		}
+
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+
+		return unmarshalValue(s, v.Elem(), codec)
+	}
+
+	switch codec.kind {
+	case "nbt":
+		return s.ReadNBT(v.Addr().Interface())
+	case "json":
+		data, err := s.ReadStringMax(maxString(codec))
+		if err != nil {
+			return err
+		}
+
+		return json.Unmarshal([]byte(data), v.Addr().Interface())
+	}
+
+	if v.Addr().Type().Implements(unmarshalerType) {
+		return v.Addr().Interface().(Unmarshaler).UnmarshalPacket(s)
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		return unmarshalStruct(s, v)
+	case reflect.Slice:
+		if codec.rest {
+			data, err := io.ReadAll(s)
+			if err != nil {
+				return err
+			}
+
+			v.Set(reflect.ValueOf(data).Convert(v.Type()))
+			return nil
+		}
+
+		length, err := s.ReadVarInt()
+		if err != nil {
+			return err
+		}
+
+		if length < 0 || (codec.max > 0 && length > codec.max) {
+			return ErrInvalidData
+		}
+
+		if codec.kind == "" && v.Type().Elem().Kind() == reflect.Uint8 {
+			// The length is checked against the packet before the data is
+			// allocated.
+			data, err := s.readBytes(length)
+			if err != nil {
+				return err
+			}
+
+			v.Set(reflect.ValueOf(data).Convert(v.Type()))
+			return nil
+		}
+
+		// The slice is grown as elements are read, so that a large length
+		// can't allocate more than the packet holds.
+		v.Set(reflect.MakeSlice(v.Type(), 0, 0))
+		element := codec
+		element.max = 0
+		for i := 0; i < length; i++ {
+			elementValue := reflect.New(v.Type().Elem()).Elem()
+			if err := unmarshalValue(s, elementValue, element); err != nil {
+				return err
+			}
+			v.Set(reflect.Append(v, elementValue))
+		}
+
+		return nil
+	case reflect.Array:
+		if codec.kind == "" && v.Type().Elem().Kind() == reflect.Uint8 {
+			data := make([]byte, v.Len())
+			if err := s.ReadFull(data); err != nil {
+				return err
+			}
+
+			for i, b := range data {
+				v.Index(i).SetUint(uint64(b))
+			}
+			return nil
+		}
+
+		for i := 0; i < v.Len(); i++ {
+			if err := unmarshalValue(s, v.Index(i), codec); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	kind := codec.kind
+	if kind == "" {
+		kind = inferKind(v.Kind())
+	}
+
+	switch kind {
+	case "varint":
+		value, err := s.ReadVarInt()
+		if err != nil {
+			return err
+		}
+		setInt(v, int64(value))
+	case "varlong":
+		value, err := s.ReadVarInt64()
+		if err != nil {
+			return err
+		}
+		setInt(v, value)
+	case "bool":
+		value, err := s.ReadBoolean()
+		if err != nil {
+			return err
+		}
+		v.SetBool(value)
+	case "byte":
+		value, err := s.ReadSignedByte()
+		if err != nil {
+			return err
+		}
+		setInt(v, int64(value))
+	case "ubyte":
+		value, err := s.ReadByte()
+		if err != nil {
+			return err
+		}
+		setInt(v, int64(value))
+	case "short":
+		value, err := s.ReadInt16()
+		if err != nil {
+			return err
+		}
+		setInt(v, int64(value))
+	case "ushort":
+		value, err := s.ReadUInt16()
+		if err != nil {
+			return err
+		}
+		setInt(v, int64(value))
+	case "int":
+		value, err := s.ReadInt32()
+		if err != nil {
+			return err
+		}
+		setInt(v, int64(value))
+	case "long":
+		value, err := s.ReadInt64()
+		if err != nil {
+			return err
+		}
+		setInt(v, value)
+	case "float":
+		value, err := s.ReadFloat32()
+		if err != nil {
+			return err
+		}
+		v.SetFloat(float64(value))
+	case "double":
+		value, err := s.ReadFloat64()
+		if err != nil {
+			return err
+		}
+		v.SetFloat(value)
+	case "string":
+		value, err := s.ReadStringMax(maxString(codec))
+		if err != nil {
+			return err
+		}
+		v.SetString(value)
+	default:
+		return fmt.Errorf("protocol: %s: can't unmarshal %s", codec.name,
+			v.Type())
+	}
+
+	return nil
+}
+
+// intValue returns the value of an integer field, signed or unsigned.
+func intValue(v reflect.Value) int64 {
+	switch v.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64, reflect.Uintptr:
+		return int64(v.Uint())
+	}
+
+	return v.Int()
+}
+
+// setInt sets an integer field, signed or unsigned.
+func setInt(v reflect.Value, value int64) {
+	switch v.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64, reflect.Uintptr:
+		v.SetUint(uint64(value))
+	default:
+		v.SetInt(value)
+	}
+}
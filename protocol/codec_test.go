@@ -0,0 +1,268 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type codecInner struct {
+	Name  string `mc:"string,max=16"`
+	Value int32
+}
+
+type codecNBT struct {
+	Text  string `nbt:"text"`
+	Count int32  `nbt:"count"`
+}
+
+type codecJSON struct {
+	Text  string `json:"text"`
+	Count int    `json:"count"`
+}
+
+// codecHook encodes itself with a prefix, to test the Marshaler hooks.
+type codecHook string
+
+func (h codecHook) MarshalPacket(p *Packet) error {
+	p.WriteString("hook:" + string(h))
+	return nil
+}
+
+func (h *codecHook) UnmarshalPacket(s Stream) error {
+	value, err := s.ReadString()
+	if err != nil {
+		return err
+	}
+
+	if !strings.HasPrefix(value, "hook:") {
+		return ErrInvalidData
+	}
+
+	*h = codecHook(strings.TrimPrefix(value, "hook:"))
+	return nil
+}
+
+type codecAll struct {
+	VarInt   int   `mc:"varint"`
+	VarLong  int64 `mc:"varlong"`
+	Bool     bool
+	Byte     int8 `mc:"byte"`
+	UByte    uint8
+	Short    int16
+	UShort   uint16 `mc:"ushort"`
+	Int      int32
+	Long     uint64 `mc:"long"`
+	Float    float32
+	Double   float64
+	Name     string  `mc:"string,max=16"`
+	Optional *int32  `mc:"int,optional"`
+	Missing  *string `mc:",optional"`
+	List     []int   `mc:"varint,max=4"`
+	Fixed    [2]uint16
+	Bytes    []byte
+	Inner    codecInner
+	Inners   []codecInner
+	Hook     codecHook
+	UUID     UUID
+	Position Position
+	NBT      codecNBT  `mc:"nbt"`
+	JSON     codecJSON `mc:"json,max=64"`
+	Skipped  int       `mc:"-"`
+	Rest     []byte    `mc:",rest"`
+}
+
+// roundTrip marshals v, and unmarshals it into result.
+func roundTrip(t *testing.T, v interface{}, result interface{}) {
+	p := &Packet{}
+	if err := Marshal(p, v); err != nil {
+		t.Fatalf("Marshal(%T): %v", v, err)
+	}
+
+	ps := NewSliceStream(p.Data)
+	if err := Unmarshal(ps.Stream, result); err != nil {
+		t.Fatalf("Unmarshal(%T): %v", result, err)
+	}
+
+	if ps.GetRemainingBytes() != 0 {
+		t.Errorf("Unmarshal(%T) left %d bytes", result,
+			ps.GetRemainingBytes())
+	}
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	optional := int32(-7)
+	value := codecAll{
+		VarInt:   -1,
+		VarLong:  1 << 40,
+		Bool:     true,
+		Byte:     -2,
+		UByte:    250,
+		Short:    -300,
+		UShort:   25565,
+		Int:      -70000,
+		Long:     1 << 63,
+		Float:    1.5,
+		Double:   -2.25,
+		Name:     "sixteen chars ok",
+		Optional: &optional,
+		List:     []int{1, 300, -1},
+		Fixed:    [2]uint16{1, 65535},
+		Bytes:    []byte{1, 2, 3},
+		Inner:    codecInner{"inner", 5},
+		Inners:   []codecInner{{"a", 1}, {"b", 2}},
+		Hook:     "value",
+		UUID:     UUID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+		Position: Position{X: -1, Y: 64, Z: 33554431},
+		NBT:      codecNBT{"nbt", 3},
+		JSON:     codecJSON{"json", 4},
+		Rest:     []byte{9, 8, 7},
+	}
+
+	var result codecAll
+	result.Skipped = 42
+	roundTrip(t, &value, &result)
+
+	value.Skipped = 42
+	if !reflect.DeepEqual(result, value) {
+		t.Errorf("round trip = %+v, want %+v", result, value)
+	}
+}
+
+func TestCodecEncoding(t *testing.T) {
+	type inner struct {
+		Text string
+	}
+
+	tests := []struct {
+		value interface{}
+		data  []byte
+	}{
+		{struct {
+			Value int `mc:"varint"`
+		}{300}, []byte{0xAC, 0x02}},
+		{struct {
+			Value *int32 `mc:"int,optional"`
+		}{}, []byte{0x00}},
+		{struct {
+			Values []int16
+		}{[]int16{1}}, []byte{0x01, 0x00, 0x01}},
+		{struct {
+			Inner inner
+		}{inner{"hi"}}, []byte{0x02, 'h', 'i'}},
+		// Structs tagged nbt are encoded as NBT rather than in place.
+		{struct {
+			Inner inner `mc:"nbt"`
+		}{inner{"hi"}}, []byte{0x0A, 0x08, 0x00, 0x04, 'T', 'e', 'x', 't',
+			0x00, 0x02, 'h', 'i', 0x00}},
+		{struct {
+			Inner inner `mc:"json"`
+		}{inner{"hi"}}, append([]byte{0x0D}, `{"Text":"hi"}`...)},
+		{struct {
+			Values []int32 `mc:"nbt"`
+		}{[]int32{1}}, []byte{0x0B, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00,
+			0x00, 0x01}},
+	}
+
+	for _, test := range tests {
+		p := &Packet{}
+		if err := Marshal(p, test.value); err != nil {
+			t.Errorf("Marshal(%+v): %v", test.value, err)
+			continue
+		}
+
+		if !bytes.Equal(p.Data, test.data) {
+			t.Errorf("Marshal(%+v) = % x, want % x", test.value, p.Data,
+				test.data)
+		}
+
+		result := reflect.New(reflect.TypeOf(test.value))
+		if err := Unmarshal(NewSliceStream(p.Data).Stream,
+			result.Interface()); err != nil {
+			t.Errorf("Unmarshal(%T): %v", test.value, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(result.Elem().Interface(), test.value) {
+			t.Errorf("Unmarshal(%T) = %+v, want %+v", test.value,
+				result.Elem().Interface(), test.value)
+		}
+	}
+}
+
+func TestCodecInvalidTags(t *testing.T) {
+	values := []interface{}{
+		&struct {
+			Value string `mc:"varint"`
+		}{},
+		&struct {
+			Value bool `mc:"varint"`
+		}{},
+		&struct {
+			Value float64 `mc:"string"`
+		}{},
+		&struct {
+			Value int `mc:"bool"`
+		}{},
+		&struct {
+			Values []string `mc:"long"`
+		}{},
+		&struct {
+			Value int `mc:"unknown"`
+		}{},
+		&struct {
+			Value int `mc:"varint,optional"`
+		}{},
+		&struct {
+			Value string `mc:",rest"`
+		}{},
+		&struct {
+			Value int `mc:"varint,max=x"`
+		}{},
+	}
+
+	for _, value := range values {
+		if err := Marshal(&Packet{}, value); err == nil ||
+			!strings.HasPrefix(err.Error(), "protocol: ") {
+			t.Errorf("Marshal(%T) error = %v", value, err)
+		}
+
+		if err := Unmarshal(NewSliceStream([]byte{0, 0, 0, 0}).Stream,
+			value); err == nil {
+			t.Errorf("Unmarshal(%T) succeeded", value)
+		}
+	}
+}
+
+func TestCodecLimits(t *testing.T) {
+	tooLong := struct {
+		Name string `mc:"string,max=4"`
+	}{"hello"}
+	if err := Marshal(&Packet{}, tooLong); !errors.Is(err, ErrStringTooLong) {
+		t.Errorf("Marshal string: error = %v, want ErrStringTooLong", err)
+	}
+
+	p := &Packet{}
+	p.WriteString("hello")
+	err := Unmarshal(NewSliceStream(p.Data).Stream, &tooLong)
+	var fieldErr *FieldError
+	if !errors.As(err, &fieldErr) || !errors.Is(err, ErrStringTooLong) {
+		t.Errorf("Unmarshal string: error = %v, want a FieldError", err)
+	}
+
+	tooMany := struct {
+		Values []int `mc:"varint,max=2"`
+	}{[]int{1, 2, 3}}
+	if err := Marshal(&Packet{}, tooMany); err == nil {
+		t.Error("Marshal slice: expected an error")
+	}
+
+	p = &Packet{}
+	p.WriteVarInt(3)
+	if err := Unmarshal(NewSliceStream(p.Data).Stream,
+		&tooMany); !errors.Is(err, ErrInvalidData) {
+		t.Errorf("Unmarshal slice: error = %v, want ErrInvalidData", err)
+	}
+}
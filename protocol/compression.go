@@ -0,0 +1,161 @@
+package protocol
+
+import (
+	"compress/zlib"
+	"io"
+	"sync"
+)
+
+// MaxUncompressedSize is the largest size of a compressed packet once it's
+// decompressed, as in the vanilla client and server. Packets that claim to
+// be larger are rejected before they're decompressed.
+const MaxUncompressedSize = 8388608
+
+// compression holds the compression settings shared by copies of a Stream.
+type compression struct {
+	threshold int
+}
+
+var zlibWriters = sync.Pool{
+	New: func() interface{} {
+		return zlib.NewWriter(nil)
+	},
+}
+
+var zlibReaders sync.Pool
+
+// SetCompression enables compression of packets that are at least threshold
+// bytes long, as sent by a set compression packet, or disables compression
+// if threshold is negative. When compression is enabled, packets are
+// prefixed with their uncompressed length as a VarInt, or 0 if they aren't
+// compressed, and compressed packets are compressed with zlib.
+//
+// Copies of the Stream made after it's set, including the PacketStreams it
+// returns, use the same compression.
+func (s *Stream) SetCompression(threshold int) {
+	if threshold < 0 {
+		s.compression = nil
+		return
+	}
+
+	s.compression = &compression{threshold: threshold}
+}
+
+// CompressionThreshold returns the threshold set by SetCompression, or -1
+// if compression is disabled.
+func (s Stream) CompressionThreshold() int {
+	if s.compression == nil {
+		return -1
+	}
+
+	return s.compression.threshold
+}
+
+// readCompressed reads the packet from reader, decompressing it if it's
+// compressed. The compressed packet has already been limited to limit
+// bytes, and its uncompressed length is limited to MaxUncompressedSize.
+// Limits stricter than MaxPacketSize, from MaxPacketSizes, also apply to
+// the uncompressed length, so that they can't be avoided by compressing a
+// packet.
+func (s Stream) readCompressed(reader *packetReader,
+	limit int) (PacketStream, int, error) {
+	dataLength, err := Stream{ReadWriter: reader}.ReadVarInt()
+	if err != nil {
+		return PacketStream{}, 0, err
+	}
+
+	if dataLength == 0 {
+		if reader.remaining == 0 {
+			return PacketStream{}, 0, ErrInvalidData
+		}
+
+		return PacketStream{Stream{reader, s.compression}, reader},
+			int(reader.remaining), nil
+	}
+
+	if dataLength < s.compression.threshold || dataLength < 0 {
+		return PacketStream{}, 0, ErrInvalidData
+	}
+
+	maxLength := MaxUncompressedSize
+	if limit < MaxPacketSize {
+		maxLength = limit
+	}
+
+	if dataLength > maxLength {
+		return PacketStream{}, 0, ErrPacketTooLarge
+	}
+
+	data, err := decompress(reader, dataLength)
+	if err != nil {
+		return PacketStream{}, 0, err
+	}
+
+	// Any data after the end of the zlib stream is discarded.
+	if _, err := io.CopyN(io.Discard, reader, reader.remaining); err != nil {
+		return PacketStream{}, 0, err
+	}
+
+	source := &sliceReader{data}
+	decompressed := &packetReader{
+		stream:    Stream{ReadWriter: source},
+		writer:    s,
+		remaining: int64(len(data)),
+	}
+
+	return PacketStream{Stream{decompressed, s.compression}, decompressed},
+		dataLength, nil
+}
+
+// decompress reads exactly dataLength bytes of zlib compressed data from
+// r. ErrInvalidData is returned if the data decompresses to a different
+// length, without decompressing more than one byte past dataLength.
+func decompress(r io.Reader, dataLength int) ([]byte, error) {
+	var zr io.ReadCloser
+	if pooled, ok := zlibReaders.Get().(io.ReadCloser); ok {
+		if err := pooled.(zlib.Resetter).Reset(r, nil); err != nil {
+			return nil, ErrInvalidData
+		}
+		zr = pooled
+	} else {
+		var err error
+		if zr, err = zlib.NewReader(r); err != nil {
+			return nil, ErrInvalidData
+		}
+	}
+	defer zlibReaders.Put(zr)
+
+	data := make([]byte, dataLength+1)
+	n, err := io.ReadFull(zr, data)
+	if err != io.ErrUnexpectedEOF || n != dataLength {
+		return nil, ErrInvalidData
+	}
+
+	return data[:dataLength], nil
+}
+
+// writeCompressed writes the Packet in the compressed packet format,
+// compressing it if it's at least the threshold long.
+func (s Stream) writeCompressed(p *Packet) error {
+	if len(p.Data) < s.compression.threshold {
+		return s.writeFrame(p, 0x00)
+	}
+
+	compressed := pooledPacket()
+	defer compressed.Release()
+	compressed.WriteVarInt(len(p.Data))
+
+	zw := zlibWriters.Get().(*zlib.Writer)
+	defer zlibWriters.Put(zw)
+	zw.Reset(compressed)
+
+	if _, err := zw.Write(p.Data); err != nil {
+		return err
+	}
+
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	return s.writeFrame(compressed)
+}
@@ -0,0 +1,170 @@
+package protocol
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+)
+
+// compressedFrame returns a packet in the compressed packet format with the
+// data length and body, which is written as is.
+func compressedFrame(dataLength int, body []byte) []byte {
+	data := binary.AppendUvarint(nil, uint64(dataLength))
+	data = append(data, body...)
+	return append(binary.AppendUvarint(nil, uint64(len(data))), data...)
+}
+
+func zlibCompress(data []byte) []byte {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write(data)
+	zw.Close()
+	return buf.Bytes()
+}
+
+// testPayload returns a payload of n bytes that compresses well.
+func testPayload(n int) []byte {
+	payload := make([]byte, n)
+	for i := range payload {
+		payload[i] = byte(i % 7)
+	}
+
+	return payload
+}
+
+func TestCompressionRoundTrip(t *testing.T) {
+	tests := []struct {
+		threshold  int
+		size       int
+		compressed bool
+	}{
+		{256, 10, false},
+		{256, 254, false},
+		// The packet ID makes the packet one byte longer than its payload.
+		{256, 255, true},
+		{256, 256, true},
+		{256, 4096, true},
+		{0, 0, true},
+		{0, 100, true},
+		{-1, 0, false},
+		{-1, 4096, false},
+		// Packets larger than MaxPacketSize can be read back as long as
+		// they're smaller once compressed.
+		{256, 3000000, true},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		s := NewStream(&buf)
+		s.SetCompression(test.threshold)
+		if s.CompressionThreshold() != test.threshold {
+			t.Errorf("threshold %d: CompressionThreshold() = %d",
+				test.threshold, s.CompressionThreshold())
+		}
+
+		payload := testPayload(test.size)
+		p := NewPacketWithID(0x42)
+		p.Write(payload)
+		if err := s.WritePacket(p); err != nil {
+			t.Fatalf("threshold %d, size %d: WritePacket: %v", test.threshold,
+				test.size, err)
+		}
+		p.Release()
+
+		frame := buf.Bytes()
+		_, n := binary.Uvarint(frame)
+		dataLength, _ := binary.Uvarint(frame[n:])
+		switch {
+		case test.threshold < 0:
+			if dataLength != 0x42 {
+				t.Errorf("threshold %d, size %d: packet has a data length",
+					test.threshold, test.size)
+			}
+		case test.compressed != (dataLength != 0):
+			t.Errorf("threshold %d, size %d: compressed = %v, want %v",
+				test.threshold, test.size, dataLength != 0, test.compressed)
+		}
+
+		ps, length, err := s.GetPacketStream()
+		if err != nil {
+			t.Fatalf("threshold %d, size %d: GetPacketStream: %v",
+				test.threshold, test.size, err)
+		}
+
+		if length != test.size+1 {
+			t.Errorf("threshold %d, size %d: length = %d, want %d",
+				test.threshold, test.size, length, test.size+1)
+		}
+
+		id, err := ps.ReadVarInt()
+		if err != nil || id != 0x42 {
+			t.Errorf("threshold %d, size %d: packet ID = %#x, %v",
+				test.threshold, test.size, id, err)
+		}
+
+		data, err := io.ReadAll(ps)
+		if err != nil || !bytes.Equal(data, payload) {
+			t.Errorf("threshold %d, size %d: payload doesn't match, %v",
+				test.threshold, test.size, err)
+		}
+
+		if buf.Len() != 0 {
+			t.Errorf("threshold %d, size %d: %d bytes left unread",
+				test.threshold, test.size, buf.Len())
+		}
+	}
+}
+
+func TestCompressionInvalid(t *testing.T) {
+	payload := testPayload(1000)
+	bomb := zlibCompress(make([]byte, 10000000))
+
+	tests := []struct {
+		name  string
+		limit int
+		frame []byte
+		err   error
+	}{
+		{"valid", MaxPacketSize, compressedFrame(1000, zlibCompress(payload)),
+			nil},
+		{"data length too large", MaxPacketSize,
+			compressedFrame(1001, zlibCompress(payload)), ErrInvalidData},
+		{"data length too small", MaxPacketSize,
+			compressedFrame(999, zlibCompress(payload)), ErrInvalidData},
+		{"data length below threshold", MaxPacketSize,
+			compressedFrame(100, zlibCompress(payload[:100])), ErrInvalidData},
+		{"zlib bomb", MaxPacketSize, compressedFrame(1000, bomb),
+			ErrInvalidData},
+		{"invalid zlib", MaxPacketSize, compressedFrame(1000, payload),
+			ErrInvalidData},
+		{"empty uncompressed", MaxPacketSize, compressedFrame(0, nil),
+			ErrInvalidData},
+		{"too large", MaxPacketSize,
+			compressedFrame(MaxUncompressedSize+1, bomb), ErrPacketTooLarge},
+		{"state limit", MaxPacketSizes[StateStatus],
+			compressedFrame(1000, zlibCompress(payload)), ErrPacketTooLarge},
+	}
+
+	for _, test := range tests {
+		s := NewStream(bytes.NewBuffer(test.frame))
+		s.SetCompression(256)
+
+		ps, _, err := s.GetPacketStreamLimit(test.limit)
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: error = %v, want %v", test.name, err, test.err)
+			continue
+		}
+
+		if err != nil {
+			continue
+		}
+
+		data, err := io.ReadAll(ps)
+		if err != nil || !bytes.Equal(data, payload) {
+			t.Errorf("%s: payload doesn't match, %v", test.name, err)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package protocol
+
+import (
+	"unicode/utf16"
+)
+
+// ReadLegacyString reads a string as used by pre-1.7 (legacy) clients, which
+// is the length of the string in UTF-16 code units as an uint16, followed by
+// the UTF-16BE encoded string.
+func (s Stream) ReadLegacyString() (string, error) {
+	length, err := s.ReadUInt16()
+	if err != nil {
+		return "", err
+	}
+
+	data := make([]byte, int(length)*2)
+	err = s.ReadFull(data)
+	if err != nil {
+		return "", err
+	}
+
+	return DecodeUTF16BE(data), nil
+}
+
+// DecodeUTF16BE decodes UTF-16BE encoded data into a string. A trailing odd
+// byte is ignored.
+func DecodeUTF16BE(data []byte) string {
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = uint16(data[i*2])<<8 | uint16(data[i*2+1])
+	}
+
+	return string(utf16.Decode(units))
+}
+
+// WriteLegacyString writes a string as used by pre-1.7 (legacy) clients
+// to the Packet. See ReadLegacyString.
+func (p *Packet) WriteLegacyString(data string) {
+	units := utf16.Encode([]rune(data))
+	p.WriteUInt16(uint16(len(units)))
+	p.grow(len(units) * 2)
+	for _, unit := range units {
+		p.Data = append(p.Data, byte(unit>>8), byte(unit))
+	}
+}
@@ -0,0 +1,70 @@
+package protocol
+
+import (
+	"github.com/1lann/beacon/protocol/nbt"
+)
+
+// NetworkNBTProtocol is the protocol number of 1.20.2, the first release
+// that sends NBT in packets without a name for the root tag.
+const NetworkNBTProtocol = 764
+
+// ReadNBT reads a tag in the network NBT form and unmarshals it into the
+// value pointed to by v, using nbt.Unmarshal. v is left unchanged if the
+// root tag is a TAG_End. Clients before 1.20.2 send NBT with a named root
+// tag, which is read by ReadNamedNBT.
+func (s Stream) ReadNBT(v interface{}) error {
+	tag, err := nbt.ReadNetwork(s)
+	if err != nil {
+		return err
+	}
+
+	return nbt.Unmarshal(tag, v)
+}
+
+// ReadNamedNBT reads a tag with a named root tag and unmarshals it into the
+// value pointed to by v, returning the name of the root tag.
+func (s Stream) ReadNamedNBT(v interface{}) (string, error) {
+	name, tag, err := nbt.Read(s)
+	if err != nil {
+		return "", err
+	}
+
+	return name, nbt.Unmarshal(tag, v)
+}
+
+// WriteNBT marshals v using nbt.Marshal, and writes it to the Packet in the
+// network NBT form. A nil v is written as a TAG_End.
+func (p *Packet) WriteNBT(v interface{}) error {
+	var tag nbt.Tag
+	if v != nil {
+		var err error
+		if tag, err = nbt.Marshal(v); err != nil {
+			return err
+		}
+	}
+
+	data, err := nbt.AppendNetwork(nil, tag)
+	if err != nil {
+		return err
+	}
+
+	p.Write(data)
+	return nil
+}
+
+// WriteNamedNBT marshals v using nbt.Marshal, and writes it to the Packet
+// with a named root tag, as used by clients before 1.20.2.
+func (p *Packet) WriteNamedNBT(name string, v interface{}) error {
+	tag, err := nbt.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	data, err := nbt.AppendNamed(nil, name, tag)
+	if err != nil {
+		return err
+	}
+
+	p.Write(data)
+	return nil
+}
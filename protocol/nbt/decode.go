@@ -0,0 +1,377 @@
+package nbt
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"unicode/utf16"
+)
+
+// The default limits of a Decoder, which match those used by the vanilla
+// client and server for NBT received over the network.
+const (
+	DefaultMaxDepth = 512
+	DefaultMaxSize  = 2 * 1024 * 1024
+)
+
+// A Decoder reads NBT from an input stream, rejecting data that exceeds its
+// limits before allocating memory for it. It never reads past the end of
+// the tag being decoded.
+type Decoder struct {
+	// MaxDepth is the maximum depth that compounds and lists may be nested
+	// to.
+	MaxDepth int
+	// MaxSize is the maximum number of bytes that may be read for a tag.
+	MaxSize int64
+
+	r      io.Reader
+	read   int64
+	buffer [8]byte
+}
+
+// NewDecoder returns a new decoder that reads from r with the default
+// limits.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{
+		MaxDepth: DefaultMaxDepth,
+		MaxSize:  DefaultMaxSize,
+		r:        r,
+	}
+}
+
+// Read reads a tag with a named root tag from r, and returns its name.
+func Read(r io.Reader) (string, Tag, error) {
+	return NewDecoder(r).Read()
+}
+
+// ReadNetwork reads a tag in the network NBT form from r. A nil tag is
+// returned if the root tag is a TAG_End.
+func ReadNetwork(r io.Reader) (Tag, error) {
+	return NewDecoder(r).ReadNetwork()
+}
+
+// Read reads a tag with a named root tag, and returns its name.
+func (d *Decoder) Read() (string, Tag, error) {
+	d.read = 0
+	tagType, err := d.readTagType()
+	if err != nil {
+		return "", nil, err
+	}
+
+	if tagType == TagEnd {
+		return "", nil, ErrInvalidTag
+	}
+
+	name, err := d.readString()
+	if err != nil {
+		return "", nil, err
+	}
+
+	tag, err := d.readPayload(tagType, 0)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return name, tag, nil
+}
+
+// ReadNetwork reads a tag in the network NBT form. A nil tag is returned if
+// the root tag is a TAG_End.
+func (d *Decoder) ReadNetwork() (Tag, error) {
+	d.read = 0
+	tagType, err := d.readTagType()
+	if err != nil || tagType == TagEnd {
+		return nil, err
+	}
+
+	return d.readPayload(tagType, 0)
+}
+
+// reserve accounts for n more bytes being read, failing if the total would
+// exceed the maximum size.
+func (d *Decoder) reserve(n int64) error {
+	if n < 0 || n > d.MaxSize-d.read {
+		return ErrTooLarge
+	}
+
+	d.read += n
+	return nil
+}
+
+// readFull reads exactly len(data) bytes.
+func (d *Decoder) readFull(data []byte) error {
+	if err := d.reserve(int64(len(data))); err != nil {
+		return err
+	}
+
+	if _, err := io.ReadFull(d.r, data); err != nil {
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (d *Decoder) readUint8() (uint8, error) {
+	err := d.readFull(d.buffer[:1])
+	return d.buffer[0], err
+}
+
+func (d *Decoder) readUint16() (uint16, error) {
+	err := d.readFull(d.buffer[:2])
+	return binary.BigEndian.Uint16(d.buffer[:2]), err
+}
+
+func (d *Decoder) readUint32() (uint32, error) {
+	err := d.readFull(d.buffer[:4])
+	return binary.BigEndian.Uint32(d.buffer[:4]), err
+}
+
+func (d *Decoder) readUint64() (uint64, error) {
+	err := d.readFull(d.buffer[:8])
+	return binary.BigEndian.Uint64(d.buffer[:8]), err
+}
+
+func (d *Decoder) readTagType() (TagType, error) {
+	b, err := d.readUint8()
+	if err != nil {
+		return 0, err
+	}
+
+	if TagType(b) > TagLongArray {
+		return 0, ErrInvalidTag
+	}
+
+	return TagType(b), nil
+}
+
+// readLength reads the length of an array or list, and reserves the
+// minimum number of bytes its elements take.
+func (d *Decoder) readLength(elementSize int64) (int, error) {
+	length, err := d.readUint32()
+	if err != nil {
+		return 0, err
+	}
+
+	if int32(length) < 0 {
+		return 0, ErrInvalidLength
+	}
+
+	// The length is checked against the remaining size before the elements
+	// are allocated, but the bytes are only counted as they're read.
+	if err := d.reserve(int64(length) * elementSize); err != nil {
+		return 0, err
+	}
+	d.read -= int64(length) * elementSize
+
+	return int(length), nil
+}
+
+// readString reads a string in the modified UTF-8 encoding used by NBT.
+func (d *Decoder) readString() (string, error) {
+	length, err := d.readUint16()
+	if err != nil {
+		return "", err
+	}
+
+	data := make([]byte, length)
+	if err := d.readFull(data); err != nil {
+		return "", err
+	}
+
+	return decodeString(data)
+}
+
+// decodeString decodes modified UTF-8, which encodes strings as UTF-16 code
+// units, and never contains a zero byte.
+func decodeString(data []byte) (string, error) {
+	ascii := true
+	for _, b := range data {
+		if b == 0 || b >= 0x80 {
+			ascii = false
+			break
+		}
+	}
+
+	if ascii {
+		return string(data), nil
+	}
+
+	units := make([]uint16, 0, len(data))
+	for i := 0; i < len(data); {
+		b := data[i]
+		switch {
+		case b != 0 && b < 0x80:
+			units = append(units, uint16(b))
+			i++
+		case b&0xE0 == 0xC0 && i+1 < len(data) && data[i+1]&0xC0 == 0x80:
+			units = append(units, uint16(b&0x1F)<<6|uint16(data[i+1]&0x3F))
+			i += 2
+		case b&0xF0 == 0xE0 && i+2 < len(data) && data[i+1]&0xC0 == 0x80 &&
+			data[i+2]&0xC0 == 0x80:
+			units = append(units, uint16(b&0x0F)<<12|
+				uint16(data[i+1]&0x3F)<<6|uint16(data[i+2]&0x3F))
+			i += 3
+		default:
+			return "", ErrInvalidString
+		}
+	}
+
+	return string(utf16.Decode(units)), nil
+}
+
+// readPayload reads the payload of a tag of the type.
+func (d *Decoder) readPayload(tagType TagType, depth int) (Tag, error) {
+	switch tagType {
+	case TagByte:
+		b, err := d.readUint8()
+		return Byte(b), err
+	case TagShort:
+		value, err := d.readUint16()
+		return Short(value), err
+	case TagInt:
+		value, err := d.readUint32()
+		return Int(value), err
+	case TagLong:
+		value, err := d.readUint64()
+		return Long(value), err
+	case TagFloat:
+		value, err := d.readUint32()
+		return Float(math.Float32frombits(value)), err
+	case TagDouble:
+		value, err := d.readUint64()
+		return Double(math.Float64frombits(value)), err
+	case TagByteArray:
+		length, err := d.readLength(1)
+		if err != nil {
+			return nil, err
+		}
+
+		data := make(ByteArray, length)
+		return data, d.readFull(data)
+	case TagString:
+		value, err := d.readString()
+		return String(value), err
+	case TagList:
+		return d.readList(depth)
+	case TagCompound:
+		return d.readCompound(depth)
+	case TagIntArray:
+		length, err := d.readLength(4)
+		if err != nil {
+			return nil, err
+		}
+
+		values := make(IntArray, length)
+		for i := range values {
+			value, err := d.readUint32()
+			if err != nil {
+				return nil, err
+			}
+			values[i] = int32(value)
+		}
+
+		return values, nil
+	case TagLongArray:
+		length, err := d.readLength(8)
+		if err != nil {
+			return nil, err
+		}
+
+		values := make(LongArray, length)
+		for i := range values {
+			value, err := d.readUint64()
+			if err != nil {
+				return nil, err
+			}
+			values[i] = int64(value)
+		}
+
+		return values, nil
+	}
+
+	return nil, ErrInvalidTag
+}
+
+// minimumSize is the smallest number of bytes the payload of a tag of each
+// type can take.
+var minimumSize = [...]int64{
+	TagEnd:       0,
+	TagByte:      1,
+	TagShort:     2,
+	TagInt:       4,
+	TagLong:      8,
+	TagFloat:     4,
+	TagDouble:    8,
+	TagByteArray: 4,
+	TagString:    2,
+	TagList:      5,
+	TagCompound:  1,
+	TagIntArray:  4,
+	TagLongArray: 4,
+}
+
+func (d *Decoder) readList(depth int) (Tag, error) {
+	if depth >= d.MaxDepth {
+		return nil, ErrTooDeep
+	}
+
+	elementType, err := d.readTagType()
+	if err != nil {
+		return nil, err
+	}
+
+	size := minimumSize[elementType]
+	if size == 0 {
+		size = 1
+	}
+
+	length, err := d.readLength(size)
+	if err != nil {
+		return nil, err
+	}
+
+	if elementType == TagEnd && length > 0 {
+		return nil, ErrInvalidTag
+	}
+
+	list := List{ElementType: elementType, Elements: make([]Tag, length)}
+	for i := range list.Elements {
+		if list.Elements[i], err = d.readPayload(elementType,
+			depth+1); err != nil {
+			return nil, err
+		}
+	}
+
+	return list, nil
+}
+
+func (d *Decoder) readCompound(depth int) (Tag, error) {
+	if depth >= d.MaxDepth {
+		return nil, ErrTooDeep
+	}
+
+	compound := make(Compound)
+	for {
+		tagType, err := d.readTagType()
+		if err != nil {
+			return nil, err
+		}
+
+		if tagType == TagEnd {
+			return compound, nil
+		}
+
+		name, err := d.readString()
+		if err != nil {
+			return nil, err
+		}
+
+		if compound[name], err = d.readPayload(tagType, depth+1); err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package nbt
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// seedTags returns a tag of each type, used to seed the fuzz tests.
+func seedTags() []Tag {
+	nested := Compound{"compound": Compound{"list": List{
+		ElementType: TagCompound,
+		Elements:    []Tag{Compound{"byte": Byte(1)}, Compound{}},
+	}}}
+
+	return []Tag{
+		Byte(-1),
+		Short(12345),
+		Int(-123456789),
+		Long(math.MaxInt64),
+		Float(1.5),
+		Double(math.Inf(-1)),
+		ByteArray{1, 2, 3},
+		String("hello §aworld \x00 \U0001F600"),
+		List{ElementType: TagEnd},
+		List{ElementType: TagInt, Elements: []Tag{Int(1), Int(2)}},
+		List{ElementType: TagString, Elements: []Tag{String("a")}},
+		Compound{},
+		Compound{"name": String("beacon"), "count": Int(3)},
+		IntArray{1, -1, math.MaxInt32},
+		LongArray{1, -1, math.MinInt64},
+		nested,
+	}
+}
+
+// nesting returns the number of compounds and lists that the most deeply
+// nested tag is within, including the tag itself.
+func nesting(tag Tag) int {
+	var elements []Tag
+	switch tag := tag.(type) {
+	case Compound:
+		for _, element := range tag {
+			elements = append(elements, element)
+		}
+	case List:
+		elements = tag.Elements
+	default:
+		return 0
+	}
+
+	deepest := 0
+	for _, element := range elements {
+		if depth := nesting(element); depth > deepest {
+			deepest = depth
+		}
+	}
+
+	return deepest + 1
+}
+
+// decode decodes the data as a named tag, or as network NBT, with the
+// limits, and returns the number of bytes read.
+func decode(data []byte, network bool, maxDepth int,
+	maxSize int64) (Tag, int64, error) {
+	r := bytes.NewReader(data)
+	d := NewDecoder(r)
+	d.MaxDepth = maxDepth
+	d.MaxSize = maxSize
+
+	var tag Tag
+	var err error
+	if network {
+		tag, err = d.ReadNetwork()
+	} else {
+		_, tag, err = d.Read()
+	}
+
+	return tag, int64(len(data) - r.Len()), err
+}
+
+func FuzzDecode(f *testing.F) {
+	for _, tag := range seedTags() {
+		named, err := AppendNamed(nil, "root", tag)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(named, false, uint16(DefaultMaxDepth), uint32(DefaultMaxSize))
+
+		network, err := AppendNetwork(nil, tag)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(network, true, uint16(2), uint32(64))
+	}
+
+	// Lists nested deeper than the default limit, and an array that claims
+	// to be larger than the data.
+	deep := bytes.Repeat([]byte{byte(TagList), 0, 0, 0, 1}, DefaultMaxDepth+1)
+	f.Add(append([]byte{byte(TagList)}, deep[1:]...), true,
+		uint16(DefaultMaxDepth), uint32(DefaultMaxSize))
+	f.Add([]byte{byte(TagLongArray), 0x7F, 0xFF, 0xFF, 0xFF}, true,
+		uint16(DefaultMaxDepth), uint32(DefaultMaxSize))
+
+	f.Fuzz(func(t *testing.T, data []byte, network bool, maxDepth uint16,
+		maxSize uint32) {
+		depth := int(maxDepth % (DefaultMaxDepth + 1))
+		size := int64(maxSize % (DefaultMaxSize + 1))
+
+		tag, read, err := decode(data, network, depth, size)
+		if err != nil {
+			return
+		}
+
+		if read > size {
+			t.Fatalf("read %d bytes, more than MaxSize %d", read, size)
+		}
+
+		if nesting(tag) > depth {
+			t.Fatalf("decoded tags nested %d deep, more than MaxDepth %d",
+				nesting(tag), depth)
+		}
+
+		// The limits are exact, so decoding with a lower limit fails.
+		if _, _, err := decode(data, network, depth, read-1); read > 0 &&
+			!errors.Is(err, ErrTooLarge) {
+			t.Fatalf("MaxSize %d: error = %v, want ErrTooLarge", read-1, err)
+		}
+
+		if nesting(tag) > 0 {
+			_, _, err := decode(data, network, nesting(tag)-1, size)
+			if !errors.Is(err, ErrTooDeep) {
+				t.Fatalf("MaxDepth %d: error = %v, want ErrTooDeep",
+					nesting(tag)-1, err)
+			}
+		}
+
+		// Decoded tags encode to data that decodes to the same tags.
+		encoded, err := AppendNetwork(nil, tag)
+		if err != nil {
+			t.Fatalf("failed to encode decoded tag: %v", err)
+		}
+
+		decoded, _, err := decode(encoded, true, depth, DefaultMaxSize)
+		if err != nil {
+			t.Fatalf("failed to decode encoded tag: %v", err)
+		}
+
+		reencoded, err := AppendNetwork(nil, decoded)
+		if err != nil || !bytes.Equal(encoded, reencoded) {
+			t.Fatalf("tag changed after encoding and decoding: %v", err)
+		}
+	})
+}
+
+func FuzzRoundTrip(f *testing.F) {
+	f.Add(int8(1), int16(2), int32(3), int64(4), float32(5), float64(6),
+		[]byte{7}, "eight", "name")
+	f.Add(int8(-128), int16(math.MinInt16), int32(math.MinInt32),
+		int64(math.MinInt64), float32(math.NaN()), math.Inf(1), []byte(nil),
+		"\x00é\U0001F600", "")
+
+	f.Fuzz(func(t *testing.T, b int8, s int16, i int32, l int64, fl float32,
+		d float64, data []byte, str string, name string) {
+		ints := make(IntArray, len(data))
+		longs := make(LongArray, len(data))
+		bytesList := List{ElementType: TagByte, Elements: []Tag{}}
+		for index, value := range data {
+			ints[index] = int32(value) * i
+			longs[index] = int64(value) * l
+			bytesList.Elements = append(bytesList.Elements, Byte(value))
+		}
+
+		if len(data) == 0 {
+			bytesList.ElementType = TagEnd
+		}
+
+		tag := Compound{
+			"byte":      Byte(b),
+			"short":     Short(s),
+			"int":       Int(i),
+			"long":      Long(l),
+			"float":     Float(fl),
+			"double":    Double(d),
+			"byteArray": ByteArray(data),
+			"string":    String(str),
+			"list":      bytesList,
+			"compound":  Compound{name: String(name)},
+			"intArray":  ints,
+			"longArray": longs,
+		}
+
+		named, err := AppendNamed(nil, name, tag)
+		if errors.Is(err, ErrStringLength) {
+			return
+		} else if err != nil {
+			t.Fatal(err)
+		}
+
+		decodedName, decoded, err := Read(bytes.NewReader(named))
+		if err != nil {
+			t.Fatalf("failed to decode named tag: %v", err)
+		}
+
+		// Strings that aren't valid UTF-8 have their invalid bytes replaced.
+		tag["string"] = String([]rune(str))
+		tag["compound"] = Compound{string([]rune(name)): String([]rune(name))}
+		if decodedName != string([]rune(name)) {
+			t.Fatalf("name = %q, want %q", decodedName, name)
+		}
+
+		// NaN isn't equal to itself, so floats are compared by their bits.
+		decodedCompound := decoded.(Compound)
+		if math.Float32bits(float32(decodedCompound["float"].(Float))) !=
+			math.Float32bits(fl) ||
+			math.Float64bits(float64(decodedCompound["double"].(Double))) !=
+				math.Float64bits(d) {
+			t.Fatalf("floats changed: %v", decoded)
+		}
+		delete(tag, "float")
+		delete(tag, "double")
+		delete(decodedCompound, "float")
+		delete(decodedCompound, "double")
+
+		if len(data) == 0 {
+			tag["byteArray"] = ByteArray{}
+		}
+
+		if !reflect.DeepEqual(decoded, Tag(tag)) {
+			t.Fatalf("decoded %v, want %v", decoded, tag)
+		}
+
+		network, err := AppendNetwork(nil, decoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		decoded, err = ReadNetwork(bytes.NewReader(network))
+		if err != nil || !reflect.DeepEqual(decoded, Tag(tag)) {
+			t.Fatalf("network NBT decoded %v, %v, want %v", decoded, err, tag)
+		}
+	})
+}
@@ -0,0 +1,202 @@
+package nbt
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"sort"
+	"unicode/utf16"
+)
+
+// Write writes the tag to w with a named root tag, as used by files and by
+// the protocol before 1.20.2. The name is usually empty in the protocol.
+func Write(w io.Writer, name string, tag Tag) error {
+	data, err := AppendNamed(nil, name, tag)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(data)
+	return err
+}
+
+// WriteNetwork writes the tag to w as network NBT, where the root tag has
+// no name, as used by the protocol since 1.20.2. A nil tag is written as a
+// single TAG_End, which represents the absence of a tag.
+func WriteNetwork(w io.Writer, tag Tag) error {
+	data, err := AppendNetwork(nil, tag)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(data)
+	return err
+}
+
+// AppendNamed appends the tag with a named root tag to data and returns
+// the extended slice.
+func AppendNamed(data []byte, name string, tag Tag) ([]byte, error) {
+	if tag == nil {
+		return nil, ErrInvalidTag
+	}
+
+	data = append(data, byte(tag.Type()))
+	data, err := appendString(data, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return appendPayload(data, tag, 0)
+}
+
+// AppendNetwork appends the tag as network NBT to data and returns the
+// extended slice.
+func AppendNetwork(data []byte, tag Tag) ([]byte, error) {
+	if tag == nil {
+		return append(data, byte(TagEnd)), nil
+	}
+
+	data = append(data, byte(tag.Type()))
+	return appendPayload(data, tag, 0)
+}
+
+// appendPayload appends the payload of the tag, which follows its type and
+// name.
+func appendPayload(data []byte, tag Tag, depth int) ([]byte, error) {
+	if depth > DefaultMaxDepth {
+		return nil, ErrTooDeep
+	}
+
+	switch tag := tag.(type) {
+	case Byte:
+		return append(data, byte(tag)), nil
+	case Short:
+		return binary.BigEndian.AppendUint16(data, uint16(tag)), nil
+	case Int:
+		return binary.BigEndian.AppendUint32(data, uint32(tag)), nil
+	case Long:
+		return binary.BigEndian.AppendUint64(data, uint64(tag)), nil
+	case Float:
+		return binary.BigEndian.AppendUint32(data,
+			math.Float32bits(float32(tag))), nil
+	case Double:
+		return binary.BigEndian.AppendUint64(data,
+			math.Float64bits(float64(tag))), nil
+	case ByteArray:
+		if uint64(len(tag)) > math.MaxInt32 {
+			return nil, ErrInvalidLength
+		}
+
+		data = binary.BigEndian.AppendUint32(data, uint32(len(tag)))
+		return append(data, tag...), nil
+	case String:
+		return appendString(data, string(tag))
+	case List:
+		return appendList(data, tag, depth)
+	case Compound:
+		// Keys are sorted so that the encoding is deterministic.
+		keys := make([]string, 0, len(tag))
+		for key := range tag {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		var err error
+		for _, key := range keys {
+			if tag[key] == nil {
+				return nil, ErrInvalidTag
+			}
+
+			data = append(data, byte(tag[key].Type()))
+			if data, err = appendString(data, key); err != nil {
+				return nil, err
+			}
+
+			if data, err = appendPayload(data, tag[key], depth+1); err != nil {
+				return nil, err
+			}
+		}
+
+		return append(data, byte(TagEnd)), nil
+	case IntArray:
+		if uint64(len(tag)) > math.MaxInt32 {
+			return nil, ErrInvalidLength
+		}
+
+		data = binary.BigEndian.AppendUint32(data, uint32(len(tag)))
+		for _, value := range tag {
+			data = binary.BigEndian.AppendUint32(data, uint32(value))
+		}
+
+		return data, nil
+	case LongArray:
+		if uint64(len(tag)) > math.MaxInt32 {
+			return nil, ErrInvalidLength
+		}
+
+		data = binary.BigEndian.AppendUint32(data, uint32(len(tag)))
+		for _, value := range tag {
+			data = binary.BigEndian.AppendUint64(data, uint64(value))
+		}
+
+		return data, nil
+	}
+
+	return nil, ErrInvalidTag
+}
+
+// appendList appends the payload of a list tag, checking that its elements
+// are all of its element type.
+func appendList(data []byte, list List, depth int) ([]byte, error) {
+	if uint64(len(list.Elements)) > math.MaxInt32 {
+		return nil, ErrInvalidLength
+	}
+
+	elementType := list.ElementType
+	if len(list.Elements) == 0 {
+		elementType = TagEnd
+	}
+
+	data = append(data, byte(elementType))
+	data = binary.BigEndian.AppendUint32(data, uint32(len(list.Elements)))
+
+	var err error
+	for _, element := range list.Elements {
+		if element == nil || element.Type() != elementType {
+			return nil, ErrMixedList
+		}
+
+		if data, err = appendPayload(data, element, depth+1); err != nil {
+			return nil, err
+		}
+	}
+
+	return data, nil
+}
+
+// appendString appends a string in the modified UTF-8 encoding used by NBT,
+// prefixed with its length in bytes as an unsigned short.
+func appendString(data []byte, value string) ([]byte, error) {
+	lengthIndex := len(data)
+	data = append(data, 0, 0)
+
+	for _, unit := range utf16.Encode([]rune(value)) {
+		switch {
+		case unit != 0 && unit < 0x80:
+			data = append(data, byte(unit))
+		case unit < 0x800:
+			data = append(data, 0xC0|byte(unit>>6), 0x80|byte(unit&0x3F))
+		default:
+			data = append(data, 0xE0|byte(unit>>12),
+				0x80|byte(unit>>6&0x3F), 0x80|byte(unit&0x3F))
+		}
+	}
+
+	length := len(data) - lengthIndex - 2
+	if length > math.MaxUint16 {
+		return nil, ErrStringLength
+	}
+
+	binary.BigEndian.PutUint16(data[lengthIndex:], uint16(length))
+	return data, nil
+}
@@ -0,0 +1,499 @@
+package nbt
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Marshal returns the tag that encodes v. Go values are encoded as:
+//
+//   - bool, int8 and uint8 as TAG_Byte
+//   - int16 and uint16 as TAG_Short
+//   - int, int32 and uint32 as TAG_Int
+//   - int64, uint and uint64 as TAG_Long
+//   - float32 as TAG_Float, and float64 as TAG_Double
+//   - string as TAG_String
+//   - []byte, []int32 and []int64 as the array tags of those types
+//   - other slices and arrays as TAG_List
+//   - maps with string keys, and structs, as TAG_Compound
+//   - values that implement Tag as themselves
+//
+// Pointers and interfaces encode the value they point to. Nil values are
+// omitted from compounds, as NBT has no null value.
+//
+// Struct fields are encoded using their name, unless their "nbt" struct tag
+// gives another name. Like encoding/json, the tag may have the options
+// "omitempty", to omit the field if it has its zero value, and "list", to
+// encode a byte, int32 or int64 slice as a TAG_List. Fields with a tag of
+// "-" are ignored, and the fields of embedded structs are included as if
+// they were in the outer struct.
+func Marshal(v interface{}) (Tag, error) {
+	if v == nil {
+		return nil, fmt.Errorf("nbt: can't marshal nil")
+	}
+
+	return marshalValue(reflect.ValueOf(v), false, 0)
+}
+
+var tagInterface = reflect.TypeOf((*Tag)(nil)).Elem()
+
+// isNil returns whether the value has nothing to encode.
+func isNil(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Invalid:
+		return true
+	case reflect.Ptr, reflect.Interface, reflect.Map:
+		return v.IsNil()
+	}
+
+	return false
+}
+
+func marshalValue(v reflect.Value, asList bool, depth int) (Tag, error) {
+	if depth > DefaultMaxDepth {
+		return nil, ErrTooDeep
+	}
+
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, fmt.Errorf("nbt: can't marshal nil %s", v.Type())
+		}
+		v = v.Elem()
+	}
+
+	if v.Type().Implements(tagInterface) {
+		return v.Interface().(Tag), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return Byte(1), nil
+		}
+		return Byte(0), nil
+	case reflect.Int8:
+		return Byte(v.Int()), nil
+	case reflect.Uint8:
+		return Byte(v.Uint()), nil
+	case reflect.Int16:
+		return Short(v.Int()), nil
+	case reflect.Uint16:
+		return Short(v.Uint()), nil
+	case reflect.Int, reflect.Int32:
+		if v.Int() < math.MinInt32 || v.Int() > math.MaxInt32 {
+			return nil, fmt.Errorf("nbt: %d overflows TAG_Int", v.Int())
+		}
+		return Int(v.Int()), nil
+	case reflect.Uint32:
+		return Int(v.Uint()), nil
+	case reflect.Int64:
+		return Long(v.Int()), nil
+	case reflect.Uint, reflect.Uint64:
+		return Long(v.Uint()), nil
+	case reflect.Float32:
+		return Float(v.Float()), nil
+	case reflect.Float64:
+		return Double(v.Float()), nil
+	case reflect.String:
+		return String(v.String()), nil
+	case reflect.Slice, reflect.Array:
+		// Slices of tags, such as []Byte, are always encoded as lists.
+		elementType := v.Type().Elem()
+		if !asList && !elementType.Implements(tagInterface) {
+			switch elementType.Kind() {
+			case reflect.Uint8, reflect.Int8:
+				data := make(ByteArray, v.Len())
+				for i := range data {
+					data[i] = byte(v.Index(i).Convert(byteType).Uint())
+				}
+				return data, nil
+			case reflect.Int32:
+				values := make(IntArray, v.Len())
+				for i := range values {
+					values[i] = int32(v.Index(i).Int())
+				}
+				return values, nil
+			case reflect.Int64:
+				values := make(LongArray, v.Len())
+				for i := range values {
+					values[i] = v.Index(i).Int()
+				}
+				return values, nil
+			}
+		}
+
+		elements := make([]Tag, v.Len())
+		for i := range elements {
+			element, err := marshalValue(v.Index(i), false, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = element
+		}
+
+		return NewList(elements...)
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("nbt: can't marshal %s", v.Type())
+		}
+
+		compound := make(Compound, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			if isNil(iter.Value()) {
+				continue
+			}
+
+			tag, err := marshalValue(iter.Value(), false, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			compound[iter.Key().String()] = tag
+		}
+
+		return compound, nil
+	case reflect.Struct:
+		compound := make(Compound)
+		for _, field := range structFields(v.Type()) {
+			fieldValue, ok := fieldByIndex(v, field.index)
+			if !ok || isNil(fieldValue) ||
+				(field.omitEmpty && fieldValue.IsZero()) {
+				continue
+			}
+
+			tag, err := marshalValue(fieldValue, field.asList, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			compound[field.name] = tag
+		}
+
+		return compound, nil
+	}
+
+	return nil, fmt.Errorf("nbt: can't marshal %s", v.Type())
+}
+
+var byteType = reflect.TypeOf(byte(0))
+
+// field is a struct field that is encoded in a compound.
+type field struct {
+	name      string
+	index     []int
+	omitEmpty bool
+	asList    bool
+}
+
+var fieldCache sync.Map
+
+// structFields returns the encoded fields of the struct type.
+func structFields(t reflect.Type) []field {
+	if fields, found := fieldCache.Load(t); found {
+		return fields.([]field)
+	}
+
+	var fields []field
+	seen := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		structField := t.Field(i)
+		tag := structField.Tag.Get("nbt")
+		if tag == "-" {
+			continue
+		}
+
+		options := strings.Split(tag, ",")
+		if structField.Anonymous && options[0] == "" {
+			embedded := structField.Type
+			if embedded.Kind() == reflect.Ptr {
+				// Unexported pointers can't be allocated when unmarshalling.
+				if structField.PkgPath != "" {
+					continue
+				}
+				embedded = embedded.Elem()
+			}
+
+			if embedded.Kind() == reflect.Struct {
+				for _, inner := range structFields(embedded) {
+					if seen[inner.name] {
+						continue
+					}
+					seen[inner.name] = true
+
+					inner.index = append([]int{i}, inner.index...)
+					fields = append(fields, inner)
+				}
+				continue
+			}
+		}
+
+		if structField.PkgPath != "" {
+			continue
+		}
+
+		f := field{name: structField.Name, index: []int{i}}
+		if options[0] != "" {
+			f.name = options[0]
+		}
+
+		for _, option := range options[1:] {
+			switch option {
+			case "omitempty":
+				f.omitEmpty = true
+			case "list":
+				f.asList = true
+			}
+		}
+
+		if seen[f.name] {
+			continue
+		}
+		seen[f.name] = true
+		fields = append(fields, f)
+	}
+
+	fieldCache.Store(t, fields)
+	return fields
+}
+
+// fieldByIndex returns the field of the struct, or false if it's in a nil
+// embedded struct.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, fieldIndex := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(fieldIndex)
+	}
+
+	return v, true
+}
+
+// Unmarshal decodes the tag into the value pointed to by v, using the
+// mapping of Marshal. Number tags can be decoded into any number type that
+// holds their value, and integer tags into bools. Keys of compounds that
+// have no matching struct field are ignored. An interface{} or Tag is set
+// to the tag itself.
+func Unmarshal(tag Tag, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("nbt: can't unmarshal into %T", v)
+	}
+
+	return unmarshalValue(tag, rv.Elem())
+}
+
+// UnmarshalTypeError is returned when a tag can't be decoded into a value
+// of a Go type.
+type UnmarshalTypeError struct {
+	TagType TagType
+	Type    reflect.Type
+}
+
+func (e *UnmarshalTypeError) Error() string {
+	return "nbt: can't unmarshal " + e.TagType.String() + " into " +
+		e.Type.String()
+}
+
+func unmarshalValue(tag Tag, v reflect.Value) error {
+	if tag == nil {
+		return nil
+	}
+
+	typeError := &UnmarshalTypeError{TagType: tag.Type(), Type: v.Type()}
+
+	if (v.Kind() == reflect.Interface && v.NumMethod() == 0) ||
+		v.Type() == tagInterface {
+		v.Set(reflect.ValueOf(tag))
+		return nil
+	}
+
+	if v.Type().Implements(tagInterface) && v.Kind() != reflect.Ptr {
+		if reflect.TypeOf(tag) != v.Type() {
+			return typeError
+		}
+
+		v.Set(reflect.ValueOf(tag))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return unmarshalValue(tag, v.Elem())
+	case reflect.Bool:
+		value, ok := tagInt(tag)
+		if !ok {
+			return typeError
+		}
+		v.SetBool(value != 0)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Int64:
+		value, ok := tagInt(tag)
+		if !ok || v.OverflowInt(value) {
+			return typeError
+		}
+		v.SetInt(value)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64:
+		value, ok := tagInt(tag)
+		if !ok {
+			return typeError
+		}
+
+		// Unsigned values are encoded by their bits, so they're decoded
+		// from the bits of the tag's type.
+		unsigned := uint64(value)
+		switch tag.(type) {
+		case Byte:
+			unsigned = uint64(uint8(value))
+		case Short:
+			unsigned = uint64(uint16(value))
+		case Int:
+			unsigned = uint64(uint32(value))
+		}
+
+		if v.OverflowUint(unsigned) {
+			return typeError
+		}
+		v.SetUint(unsigned)
+	case reflect.Float32, reflect.Float64:
+		switch tag := tag.(type) {
+		case Float:
+			v.SetFloat(float64(tag))
+		case Double:
+			v.SetFloat(float64(tag))
+		default:
+			value, ok := tagInt(tag)
+			if !ok {
+				return typeError
+			}
+			v.SetFloat(float64(value))
+		}
+	case reflect.String:
+		value, ok := tag.(String)
+		if !ok {
+			return typeError
+		}
+		v.SetString(string(value))
+	case reflect.Slice, reflect.Array:
+		elements, ok := tagElements(tag)
+		if !ok {
+			return typeError
+		}
+
+		if v.Kind() == reflect.Array {
+			if len(elements) > v.Len() {
+				return typeError
+			}
+			v.Set(reflect.Zero(v.Type()))
+		} else {
+			v.Set(reflect.MakeSlice(v.Type(), len(elements), len(elements)))
+		}
+
+		for i, element := range elements {
+			if err := unmarshalValue(element, v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		compound, ok := tag.(Compound)
+		if !ok || v.Type().Key().Kind() != reflect.String {
+			return typeError
+		}
+
+		if v.IsNil() {
+			v.Set(reflect.MakeMapWithSize(v.Type(), len(compound)))
+		}
+
+		for key, element := range compound {
+			value := reflect.New(v.Type().Elem()).Elem()
+			if err := unmarshalValue(element, value); err != nil {
+				return err
+			}
+			v.SetMapIndex(reflect.ValueOf(key).Convert(v.Type().Key()), value)
+		}
+	case reflect.Struct:
+		compound, ok := tag.(Compound)
+		if !ok {
+			return typeError
+		}
+
+		for _, field := range structFields(v.Type()) {
+			element, found := compound[field.name]
+			if !found {
+				continue
+			}
+
+			fieldValue := v
+			for i, fieldIndex := range field.index {
+				if i > 0 && fieldValue.Kind() == reflect.Ptr {
+					if fieldValue.IsNil() {
+						fieldValue.Set(reflect.New(fieldValue.Type().Elem()))
+					}
+					fieldValue = fieldValue.Elem()
+				}
+				fieldValue = fieldValue.Field(fieldIndex)
+			}
+
+			if err := unmarshalValue(element, fieldValue); err != nil {
+				return err
+			}
+		}
+	default:
+		return typeError
+	}
+
+	return nil
+}
+
+// tagInt returns the value of an integer tag.
+func tagInt(tag Tag) (int64, bool) {
+	switch tag := tag.(type) {
+	case Byte:
+		return int64(tag), true
+	case Short:
+		return int64(tag), true
+	case Int:
+		return int64(tag), true
+	case Long:
+		return int64(tag), true
+	}
+
+	return 0, false
+}
+
+// tagElements returns the elements of a list or array tag.
+func tagElements(tag Tag) ([]Tag, bool) {
+	switch tag := tag.(type) {
+	case List:
+		return tag.Elements, true
+	case ByteArray:
+		elements := make([]Tag, len(tag))
+		for i, value := range tag {
+			elements[i] = Byte(value)
+		}
+		return elements, true
+	case IntArray:
+		elements := make([]Tag, len(tag))
+		for i, value := range tag {
+			elements[i] = Int(value)
+		}
+		return elements, true
+	case LongArray:
+		elements := make([]Tag, len(tag))
+		for i, value := range tag {
+			elements[i] = Long(value)
+		}
+		return elements, true
+	}
+
+	return nil, false
+}
@@ -0,0 +1,147 @@
+// Package nbt implements reading and writing the Named Binary Tag (NBT)
+// format used by the Minecraft protocol, both with a named root tag and in
+// the nameless network form used since 1.20.2.
+//
+// Tags are represented by the types implementing Tag, and Go values can be
+// converted to and from tags with Marshal and Unmarshal.
+package nbt
+
+import (
+	"errors"
+	"strconv"
+)
+
+// TagType is the type of a tag, which is written before it.
+type TagType byte
+
+// The types of tags.
+const (
+	TagEnd TagType = iota
+	TagByte
+	TagShort
+	TagInt
+	TagLong
+	TagFloat
+	TagDouble
+	TagByteArray
+	TagString
+	TagList
+	TagCompound
+	TagIntArray
+	TagLongArray
+)
+
+var tagNames = [...]string{
+	TagEnd:       "TAG_End",
+	TagByte:      "TAG_Byte",
+	TagShort:     "TAG_Short",
+	TagInt:       "TAG_Int",
+	TagLong:      "TAG_Long",
+	TagFloat:     "TAG_Float",
+	TagDouble:    "TAG_Double",
+	TagByteArray: "TAG_Byte_Array",
+	TagString:    "TAG_String",
+	TagList:      "TAG_List",
+	TagCompound:  "TAG_Compound",
+	TagIntArray:  "TAG_Int_Array",
+	TagLongArray: "TAG_Long_Array",
+}
+
+func (t TagType) String() string {
+	if int(t) < len(tagNames) {
+		return tagNames[t]
+	}
+
+	return "TAG_" + strconv.Itoa(int(t))
+}
+
+// Errors returned for NBT data that is invalid or exceeds the limits of a
+// Decoder.
+var (
+	ErrInvalidTag    = errors.New("nbt: invalid tag type")
+	ErrInvalidString = errors.New("nbt: invalid modified UTF-8 string")
+	ErrInvalidLength = errors.New("nbt: invalid length")
+	ErrTooDeep       = errors.New("nbt: tags nested too deeply")
+	ErrTooLarge      = errors.New("nbt: data too large")
+	ErrMixedList     = errors.New("nbt: list elements of different types")
+	ErrStringLength  = errors.New("nbt: string too long")
+)
+
+// A Tag is an NBT tag, which is one of the types in this package.
+type Tag interface {
+	Type() TagType
+}
+
+// The types of tags.
+type (
+	Byte      int8
+	Short     int16
+	Int       int32
+	Long      int64
+	Float     float32
+	Double    float64
+	ByteArray []byte
+	String    string
+	IntArray  []int32
+	LongArray []int64
+	// Compound is a collection of named tags.
+	Compound map[string]Tag
+)
+
+// List is a list of tags that are all of the same type.
+type List struct {
+	// ElementType is the type of the elements, which is TagEnd for empty
+	// lists.
+	ElementType TagType
+	Elements    []Tag
+}
+
+// Type returns TagByte.
+func (Byte) Type() TagType { return TagByte }
+
+// Type returns TagShort.
+func (Short) Type() TagType { return TagShort }
+
+// Type returns TagInt.
+func (Int) Type() TagType { return TagInt }
+
+// Type returns TagLong.
+func (Long) Type() TagType { return TagLong }
+
+// Type returns TagFloat.
+func (Float) Type() TagType { return TagFloat }
+
+// Type returns TagDouble.
+func (Double) Type() TagType { return TagDouble }
+
+// Type returns TagByteArray.
+func (ByteArray) Type() TagType { return TagByteArray }
+
+// Type returns TagString.
+func (String) Type() TagType { return TagString }
+
+// Type returns TagList.
+func (List) Type() TagType { return TagList }
+
+// Type returns TagCompound.
+func (Compound) Type() TagType { return TagCompound }
+
+// Type returns TagIntArray.
+func (IntArray) Type() TagType { return TagIntArray }
+
+// Type returns TagLongArray.
+func (LongArray) Type() TagType { return TagLongArray }
+
+// NewList returns a list of the tags, which must all be of the same type.
+func NewList(elements ...Tag) (List, error) {
+	list := List{ElementType: TagEnd, Elements: elements}
+	for i, element := range elements {
+		if i == 0 {
+			list.ElementType = element.Type()
+		} else if element.Type() != list.ElementType {
+			return List{}, ErrMixedList
+		}
+	}
+
+	return list, nil
+}
@@ -1,16 +1,64 @@
 package protocol
 
 import (
-	"encoding/binary"
 	"errors"
+	"io"
+	"math"
+	"strings"
+	"unicode/utf8"
 )
 
 // ErrInvalidData is returned when you attempt to read a piece of data
 // that cannot possibly be of the type you are trying to read as.
 var ErrInvalidData = errors.New("protocol: invalid data")
 
+// Errors returned when data read from a client exceeds the limits of the
+// protocol. They may be wrapped in a *FieldError naming the field.
+var (
+	ErrPacketTooLarge = errors.New("protocol: packet too large")
+	ErrStringTooLong  = errors.New("protocol: string too long")
+	ErrVarIntTooBig   = errors.New("protocol: VarInt too big")
+)
+
+// The maximum number of bytes in a VarInt and a VarLong.
+const (
+	MaxVarIntSize  = 5
+	MaxVarLongSize = 10
+)
+
+// A FieldError is returned when a field of a packet can't be read.
+type FieldError struct {
+	Field string
+	Err   error
+}
+
+func (e *FieldError) Error() string {
+	return "protocol: " + e.Field + ": " +
+		strings.TrimPrefix(e.Err.Error(), "protocol: ")
+}
+
+// Unwrap returns the underlying error, so that errors.Is can be used with
+// the errors of this package.
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// fieldError wraps the error with the name of the field, unless it already
+// names a field.
+func fieldError(field string, err error) error {
+	if _, ok := err.(*FieldError); ok || err == nil {
+		return err
+	}
+
+	return &FieldError{Field: field, Err: err}
+}
+
 // ReadByte reads the next single byte from the stream.
 func (s Stream) ReadByte() (byte, error) {
+	if reader, ok := s.ReadWriter.(io.ByteReader); ok {
+		return reader.ReadByte()
+	}
+
 	data := make([]byte, 1)
 	err := s.ReadFull(data)
 	if err != nil {
@@ -20,6 +68,25 @@ func (s Stream) ReadByte() (byte, error) {
 	return data[0], nil
 }
 
+// readUint reads the next n bytes as a big endian unsigned integer, without
+// allocating when the stream can read single bytes.
+func (s Stream) readUint(n int) (uint64, error) {
+	var value uint64
+	for i := 0; i < n; i++ {
+		b, err := s.ReadByte()
+		if err != nil {
+			if i > 0 && err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+
+		value = value<<8 | uint64(b)
+	}
+
+	return value, nil
+}
+
 // ReadBoolean reads the next byte as a boolean from the stream.
 func (s Stream) ReadBoolean() (bool, error) {
 	b, err := s.ReadByte()
@@ -48,76 +115,78 @@ func (s Stream) ReadSignedByte() (int8, error) {
 
 // ReadInt16 reads the next 2 bytes as an int16 (a short) from the stream.
 func (s Stream) ReadInt16() (int16, error) {
-	b := make([]byte, 2)
-	err := s.DecodeReadFull(b)
+	value, err := s.readUint(2)
 	if err != nil {
 		return 0, err
 	}
 
-	return int16(binary.LittleEndian.Uint16(b)), nil
+	return int16(value), nil
 }
 
 // ReadUInt16 reads the next 2 bytes as an uint16 (an unsigned short)
 // from the stream.
 func (s Stream) ReadUInt16() (uint16, error) {
-	b := make([]byte, 2)
-	err := s.DecodeReadFull(b)
+	value, err := s.readUint(2)
 	if err != nil {
 		return 0, err
 	}
 
-	return binary.LittleEndian.Uint16(b), nil
+	return uint16(value), nil
 }
 
 // ReadInt32 reads the next 4 bytes as an int32 from the stream.
 func (s Stream) ReadInt32() (int32, error) {
-	b := make([]byte, 4)
-	err := s.DecodeReadFull(b)
+	value, err := s.readUint(4)
 	if err != nil {
 		return 0, err
 	}
 
-	return int32(binary.LittleEndian.Uint32(b)), nil
+	return int32(value), nil
 }
 
 // ReadInt64 reads the next 8 bytes as an int64 (a long) from the stream.
 func (s Stream) ReadInt64() (int64, error) {
-	b := make([]byte, 8)
-	err := s.DecodeReadFull(b)
+	value, err := s.readUint(8)
 	if err != nil {
 		return 0, err
 	}
 
-	return int64(binary.LittleEndian.Uint64(b)), nil
+	return int64(value), nil
 }
 
 // ReadFloat32 reads the next 4 bytes as a float32 (a single-precision float)
 // from the stream.
 func (s Stream) ReadFloat32() (float32, error) {
-	var result float32
-	err := binary.Read(s, binary.LittleEndian, &result)
+	value, err := s.ReadInt32()
 	if err != nil {
 		return 0, err
 	}
 
-	return result, nil
+	return math.Float32frombits(uint32(value)), nil
 }
 
 // ReadFloat64 reads the next 8 bytes as a float64 (a double-precision float)
 // from the stream.
 func (s Stream) ReadFloat64() (float64, error) {
-	var result float64
-	err := binary.Read(s, binary.LittleEndian, &result)
+	value, err := s.ReadInt64()
 	if err != nil {
 		return 0, err
 	}
 
-	return result, nil
+	return math.Float64frombits(uint64(value)), nil
 }
 
 // ReadString reads the next ReadVarInt bytes + the length of the VarInt
-// and returns the string data from the stream.
+// and returns the string data from the stream. The string may be up to
+// DefaultMaxString characters long.
 func (s Stream) ReadString() (string, error) {
+	return s.ReadStringMax(DefaultMaxString)
+}
+
+// ReadStringMax is like ReadString, but returns ErrStringTooLong if the
+// string is longer than max characters. The length in bytes is checked
+// before the string is read.
+func (s Stream) ReadStringMax(max int) (string, error) {
 	length, err := s.ReadVarInt()
 	if err != nil {
 		return "", err
@@ -127,31 +196,47 @@ func (s Stream) ReadString() (string, error) {
 		return "", ErrInvalidData
 	}
 
+	// Each character takes at most 4 bytes in UTF-8.
+	if length > max*4 {
+		return "", ErrStringTooLong
+	}
+
 	data := make([]byte, length)
 	err = s.ReadFull(data)
 	if err != nil {
 		return "", err
 	}
 
+	if utf8.RuneCount(data) > max {
+		return "", ErrStringTooLong
+	}
+
 	return string(data), nil
 }
 
 // ReadVarInt reads the next couple of bytes which corresponds to a VarInt
-// as an int from the stream.
+// as an int from the stream. VarInts hold 32-bit integers, so
+// ErrVarIntTooBig is returned if it's longer than MaxVarIntSize bytes.
 func (s Stream) ReadVarInt() (int, error) {
-	num, err := s.ReadVarInt64()
+	num, err := s.readVarInt(MaxVarIntSize)
 	if err != nil {
 		return 0, err
 	}
-	return int(num), nil
+	return int(int32(num)), nil
 }
 
-// ReadVarInt64 reads the next couple of bytes which corresponds to a VarInt
-// as an int64 from the stream.
+// ReadVarInt64 reads the next couple of bytes which corresponds to a VarLong
+// as an int64 from the stream. ErrVarIntTooBig is returned if it's longer
+// than MaxVarLongSize bytes.
+func (s Stream) ReadVarInt64() (int64, error) {
+	return s.readVarInt(MaxVarLongSize)
+}
+
+// readVarInt reads a VarInt of at most maxSize bytes.
 //
 // This code is taken from thinkofdeath's steven
 // (github.com/thinkofdeath/steven).
-func (s Stream) ReadVarInt64() (int64, error) {
+func (s Stream) readVarInt(maxSize uint) (int64, error) {
 	var size uint
 	var num uint64
 
@@ -163,14 +248,96 @@ func (s Stream) ReadVarInt64() (int64, error) {
 
 		num |= (uint64(b) & uint64(0x7F)) << (size * 7)
 		size++
-		if size > 10 {
-			return 0, ErrInvalidData
-		}
 
 		if (b & 0x80) == 0 {
 			break
 		}
+
+		if size >= maxSize {
+			return 0, ErrVarIntTooBig
+		}
 	}
 
 	return int64(num), nil
 }
+
+// ReadByteArray reads a byte array prefixed with its length as a VarInt
+// from the stream. A max greater than zero limits the length of the array.
+func (s Stream) ReadByteArray(max int) ([]byte, error) {
+	length, err := s.ReadVarInt()
+	if err != nil {
+		return nil, err
+	}
+
+	if length < 0 || (max > 0 && length > max) {
+		return nil, ErrInvalidData
+	}
+
+	return s.readBytes(length)
+}
+
+// readBytes reads length bytes from the stream, where the length was sent
+// by the client. The length is checked against what's left of the packet
+// before it's allocated, and streams that aren't limited to a packet are
+// read in chunks, so that a large length can't allocate more than the
+// stream holds.
+func (s Stream) readBytes(length int) ([]byte, error) {
+	if reader, ok := s.ReadWriter.(*packetReader); ok {
+		if int64(length) > reader.remaining {
+			return nil, io.ErrUnexpectedEOF
+		}
+
+		data := make([]byte, length)
+		if err := s.ReadFull(data); err != nil {
+			return nil, err
+		}
+
+		return data, nil
+	}
+
+	chunkSize := length
+	if chunkSize > bufferSize {
+		chunkSize = bufferSize
+	}
+
+	data := make([]byte, 0, chunkSize)
+	for len(data) < length {
+		n := length - len(data)
+		if n > bufferSize {
+			n = bufferSize
+		}
+
+		data = append(data, make([]byte, n)...)
+		if err := s.ReadFull(data[len(data)-n:]); err != nil {
+			if err == io.EOF && len(data) > n {
+				err = io.ErrUnexpectedEOF
+			}
+
+			return nil, err
+		}
+	}
+
+	return data, nil
+}
+
+// ReadFixedPoint32 reads the next 4 bytes as a fixed-point number with 5
+// fractional bits, as used for positions before 1.9.
+func (s Stream) ReadFixedPoint32() (float64, error) {
+	value, err := s.ReadInt32()
+	if err != nil {
+		return 0, err
+	}
+
+	return float64(value) / 32, nil
+}
+
+// ReadFixedPoint8 reads the next byte as a fixed-point number with 5
+// fractional bits, as used for relative movements before 1.9.
+func (s Stream) ReadFixedPoint8() (float64, error) {
+	value, err := s.ReadSignedByte()
+	if err != nil {
+		return 0, err
+	}
+
+	return float64(value) / 32, nil
+}
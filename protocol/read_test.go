@@ -0,0 +1,260 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"testing"
+)
+
+func TestReadByteArrayLength(t *testing.T) {
+	// A packet with a byte array that claims to be 0x7fffffff bytes long.
+	claim := []byte{0x05, 0xff, 0xff, 0xff, 0xff, 0x07}
+
+	ps, _, err := NewStream(bytes.NewBuffer(claim)).GetPacketStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ps.ReadByteArray(0); err != io.ErrUnexpectedEOF {
+		t.Errorf("packet: error = %v, want io.ErrUnexpectedEOF", err)
+	}
+
+	s := NewStream(bytes.NewBuffer(append(claim[1:], 1, 2, 3)))
+	if _, err := s.ReadByteArray(0); err != io.ErrUnexpectedEOF {
+		t.Errorf("stream: error = %v, want io.ErrUnexpectedEOF", err)
+	}
+
+	data := append([]byte{0x88, 0x27}, bytes.Repeat([]byte{1}, 5000)...)
+	s = NewStream(bytes.NewBuffer(data))
+	if result, err := s.ReadByteArray(0); err != nil ||
+		!bytes.Equal(result, data[2:]) {
+		t.Errorf("stream: ReadByteArray = %d bytes, %v", len(result), err)
+	}
+}
+
+func TestUnmarshalByteSliceLength(t *testing.T) {
+	var value struct {
+		Data []byte
+	}
+
+	claim := []byte{0x05, 0xff, 0xff, 0xff, 0xff, 0x07}
+	ps, _, err := NewStream(bytes.NewBuffer(claim)).GetPacketStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Unmarshal(ps.Stream, &value); !errors.Is(err,
+		io.ErrUnexpectedEOF) {
+		t.Errorf("error = %v, want io.ErrUnexpectedEOF", err)
+	}
+}
+
+func TestReadVarIntLimits(t *testing.T) {
+	tests := []struct {
+		data  []byte
+		value int64
+		long  bool
+		err   error
+	}{
+		{[]byte{0x00}, 0, false, nil},
+		{[]byte{0x7F}, 127, false, nil},
+		{[]byte{0x80, 0x01}, 128, false, nil},
+		{[]byte{0xFF, 0xFF, 0xFF, 0xFF, 0x07}, math.MaxInt32, false, nil},
+		{[]byte{0xFF, 0xFF, 0xFF, 0xFF, 0x0F}, -1, false, nil},
+		{[]byte{0x80, 0x80, 0x80, 0x80, 0x08}, math.MinInt32, false, nil},
+		{[]byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x01}, 0, false, ErrVarIntTooBig},
+		{[]byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x01}, 1<<36 - 1, true,
+			nil},
+		{[]byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x7F},
+			math.MaxInt64, true, nil},
+		{[]byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x01},
+			-1, true, nil},
+		{[]byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF,
+			0x01}, 0, true, ErrVarIntTooBig},
+		{[]byte{0x80, 0x80}, 0, false, io.EOF},
+	}
+
+	for _, test := range tests {
+		s := NewStream(bytes.NewBuffer(test.data))
+		var value int64
+		var err error
+		if test.long {
+			value, err = s.ReadVarInt64()
+		} else {
+			var v int
+			v, err = s.ReadVarInt()
+			value = int64(v)
+		}
+
+		if err != test.err || value != test.value {
+			t.Errorf("% x: value = %d, %v, want %d, %v", test.data, value, err,
+				test.value, test.err)
+		}
+	}
+
+	// A VarInt that is too long is rejected after reading MaxVarIntSize
+	// bytes, without reading the rest.
+	buf := bytes.NewBuffer(bytes.Repeat([]byte{0x80}, 8))
+	if _, err := NewStream(buf).ReadVarInt(); err != ErrVarIntTooBig {
+		t.Errorf("long VarInt: error = %v, want ErrVarIntTooBig", err)
+	}
+
+	if buf.Len() != 8-MaxVarIntSize {
+		t.Errorf("long VarInt: %d bytes left, want %d", buf.Len(),
+			8-MaxVarIntSize)
+	}
+}
+
+func TestReadStringMax(t *testing.T) {
+	tests := []struct {
+		value string
+		max   int
+		err   error
+	}{
+		{"", 0, nil},
+		{"beacon", 6, nil},
+		{"beacon", 5, ErrStringTooLong},
+		// The limit is in characters, so multi-byte characters are allowed
+		// up to 4 bytes each.
+		{"éééé", 4, nil},
+		{"ééééé", 4, ErrStringTooLong},
+		{"😀😀", 2, nil},
+		{"😀😀😀", 2, ErrStringTooLong},
+	}
+
+	for _, test := range tests {
+		p := &Packet{}
+		p.WriteString(test.value)
+		value, err := NewStream(bytes.NewBuffer(p.Data)).ReadStringMax(test.max)
+		if err != test.err || (err == nil && value != test.value) {
+			t.Errorf("%q, max %d: value = %q, %v, want %v", test.value,
+				test.max, value, err, test.err)
+		}
+	}
+
+	// A length longer than 4 bytes per character is rejected before the
+	// string is read.
+	p := &Packet{}
+	p.WriteVarInt(17)
+	p.Write(bytes.Repeat([]byte{'a'}, 17))
+	buf := bytes.NewBuffer(p.Data)
+	if _, err := NewStream(buf).ReadStringMax(4); err != ErrStringTooLong {
+		t.Errorf("byte length: error = %v, want ErrStringTooLong", err)
+	}
+
+	if buf.Len() != 17 {
+		t.Errorf("byte length: %d bytes read, want none", 17-buf.Len())
+	}
+
+	p = &Packet{}
+	p.WriteVarInt(-1)
+	if _, err := NewStream(bytes.NewBuffer(p.Data)).ReadStringMax(4); err !=
+		ErrInvalidData {
+		t.Errorf("negative length: error = %v, want ErrInvalidData", err)
+	}
+}
+
+func TestMaxPacketSizes(t *testing.T) {
+	// packet returns a packet of the length, framed with its length.
+	packet := func(length int) []byte {
+		p := &Packet{}
+		p.WriteVarInt(length)
+		p.Write(make([]byte, length))
+		return p.Data
+	}
+
+	statusSize := MaxPacketSizeFor(StateStatus)
+	handshakeSize := MaxPacketSizeFor(StateHandshaking)
+	if statusSize != 9 || MaxPacketSizeFor(StateLogin) != MaxPacketSize ||
+		MaxPacketSizeFor(StateTransfer) != MaxPacketSize {
+		t.Errorf("MaxPacketSizeFor = %d, %d, %d", statusSize,
+			MaxPacketSizeFor(StateLogin), MaxPacketSizeFor(StateTransfer))
+	}
+
+	tests := []struct {
+		state  State
+		length int
+		err    error
+	}{
+		{StateHandshaking, handshakeSize, nil},
+		{StateHandshaking, handshakeSize + 1, ErrPacketTooLarge},
+		{StateStatus, statusSize, nil},
+		{StateStatus, statusSize + 1, ErrPacketTooLarge},
+		{StateLogin, 5000, nil},
+		{StateLogin, MaxPacketSize + 1, ErrPacketTooLarge},
+	}
+
+	for _, test := range tests {
+		var data []byte
+		if test.err == nil {
+			data = packet(test.length)
+		} else {
+			// Oversized packets are rejected from their length alone.
+			p := &Packet{}
+			p.WriteVarInt(test.length)
+			data = p.Data
+		}
+
+		s := NewStream(bytes.NewBuffer(data))
+		_, length, err := s.GetPacketStreamLimit(MaxPacketSizeFor(test.state))
+		if err != test.err || (err == nil && length != test.length) {
+			t.Errorf("%s, %d bytes: length = %d, %v, want %v", test.state,
+				test.length, length, err, test.err)
+		}
+	}
+
+	// The limit of a compressed packet applies to its uncompressed length
+	// too, so that a small packet can't decompress into a large one.
+	p := &Packet{}
+	p.WriteVarInt(3)
+	p.WriteVarInt(statusSize + 1)
+	p.WriteByte(0)
+	s := NewStream(bytes.NewBuffer(p.Data))
+	s.SetCompression(1)
+	if _, _, err := s.GetPacketStreamLimit(statusSize); err !=
+		ErrPacketTooLarge {
+		t.Errorf("compressed: error = %v, want ErrPacketTooLarge", err)
+	}
+}
+
+type fieldErrorInner struct {
+	Name string `mc:"string,max=2"`
+}
+
+type fieldErrorPacket struct {
+	Inner fieldErrorInner
+}
+
+func TestFieldError(t *testing.T) {
+	err := fieldError("name", ErrStringTooLong)
+	if !errors.Is(err, ErrStringTooLong) {
+		t.Errorf("errors.Is(%v, ErrStringTooLong) = false", err)
+	}
+
+	if message := err.Error(); message !=
+		"protocol: name: string too long" {
+		t.Errorf("message = %q", message)
+	}
+
+	// Errors that already name a field aren't wrapped again, so that the
+	// innermost field is reported.
+	if wrapped := fieldError("outer", err); wrapped != err {
+		t.Errorf("wrapped = %v, want %v", wrapped, err)
+	}
+
+	if fieldError("name", nil) != nil {
+		t.Error("nil error was wrapped")
+	}
+
+	var nested fieldErrorPacket
+	p := &Packet{}
+	p.WriteString("long")
+	err = Unmarshal(NewSliceStream(p.Data).Stream, &nested)
+	var fieldErr *FieldError
+	if !errors.As(err, &fieldErr) || fieldErr.Field != "fieldErrorInner.Name" ||
+		errors.Unwrap(err) != ErrStringTooLong {
+		t.Errorf("nested: error = %v, want a FieldError for Name", err)
+	}
+}
@@ -0,0 +1,404 @@
+package protocol
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"github.com/1lann/beacon/versions"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// State is the state of a connection, which determines the packets that
+// can be sent. The values of the states that a client can request in its
+// handshake match the values it sends.
+type State int
+
+// The states of a connection.
+const (
+	StateHandshaking State = iota
+	StateStatus
+	StateLogin
+	// StateTransfer is a login by a client that was transferred from another
+	// server, which uses the packets of StateLogin.
+	StateTransfer
+	// StateConfiguration follows a successful login since 1.20.2.
+	StateConfiguration
+	StatePlay
+)
+
+var stateNames = map[State]string{
+	StateHandshaking:   "handshaking",
+	StateStatus:        "status",
+	StateLogin:         "login",
+	StateTransfer:      "transfer",
+	StateConfiguration: "configuration",
+	StatePlay:          "play",
+}
+
+func (s State) String() string {
+	if name, found := stateNames[s]; found {
+		return name
+	}
+
+	return "state " + strconv.Itoa(int(s))
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (s State) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (s *State) UnmarshalText(text []byte) error {
+	for state, name := range stateNames {
+		if strings.EqualFold(name, string(text)) {
+			*s = state
+			return nil
+		}
+	}
+
+	return fmt.Errorf("protocol: unknown state %q", text)
+}
+
+// packetState returns the state whose packets are used in the state.
+func (s State) packetState() State {
+	if s == StateTransfer {
+		return StateLogin
+	}
+
+	return s
+}
+
+// Direction is the direction a packet is sent in.
+type Direction int
+
+// The directions that packets are sent in.
+const (
+	// Serverbound packets are sent by the client to the server.
+	Serverbound Direction = iota
+	// Clientbound packets are sent by the server to the client.
+	Clientbound
+)
+
+func (d Direction) String() string {
+	if d == Clientbound {
+		return "clientbound"
+	}
+
+	return "serverbound"
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (d Direction) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (d *Direction) UnmarshalText(text []byte) error {
+	switch strings.ToLower(string(text)) {
+	case "serverbound":
+		*d = Serverbound
+	case "clientbound":
+		*d = Clientbound
+	default:
+		return fmt.Errorf("protocol: unknown direction %q", text)
+	}
+
+	return nil
+}
+
+// A Decoder reads the fields of a packet that follow its ID, for a client
+// using the protocol number.
+type Decoder func(s Stream, protocolNumber int) (interface{}, error)
+
+// PacketDefinition describes the ID of a packet from a protocol version
+// onwards, until it's replaced by a definition with a later Since.
+type PacketDefinition struct {
+	Name      string    `json:"name"`
+	State     State     `json:"state"`
+	Direction Direction `json:"direction"`
+	// Since is the first protocol number that uses the definition.
+	Since int `json:"since"`
+	// ID is the ID of the packet, or -1 if the packet was removed.
+	ID int `json:"id"`
+	// Decode reads the fields of the packet, or is nil if the packet
+	// isn't decoded. See SetDecoder.
+	Decode Decoder `json:"-"`
+}
+
+// packetKey identifies a packet across protocol versions.
+type packetKey struct {
+	name      string
+	state     State
+	direction Direction
+}
+
+// UnknownPacketError is returned when a packet ID isn't defined for the
+// protocol version and state of a connection.
+type UnknownPacketError struct {
+	ProtocolNumber int
+	State          State
+	Direction      Direction
+	ID             int
+}
+
+func (e *UnknownPacketError) Error() string {
+	return fmt.Sprintf("protocol: unknown %s packet ID 0x%02X in %s state "+
+		"for %s", e.Direction, e.ID, e.State, versions.Name(e.ProtocolNumber))
+}
+
+//go:embed packets.json
+var bundledPackets []byte
+
+// A Registry maps packets to their IDs and decoders across protocol
+// versions, so that supporting a new version only needs its packet IDs to
+// be registered. It is safe for concurrent use.
+//
+// The bundled packets.json covers the handshaking, status, login and
+// configuration states, which are the states that beacon handles.
+type Registry struct {
+	mutex       sync.RWMutex
+	definitions map[packetKey][]PacketDefinition
+	decoders    map[packetKey]Decoder
+}
+
+// Default is the registry used by the package level functions, loaded from
+// the bundled packets.json.
+var Default = NewRegistry(nil)
+
+func init() {
+	var definitions []PacketDefinition
+	if err := json.Unmarshal(bundledPackets, &definitions); err != nil {
+		panic("protocol: invalid bundled packets.json: " + err.Error())
+	}
+
+	Default.Register(definitions...)
+}
+
+// NewRegistry returns a new registry containing the given definitions.
+func NewRegistry(definitions []PacketDefinition) *Registry {
+	r := &Registry{
+		definitions: make(map[packetKey][]PacketDefinition),
+		decoders:    make(map[packetKey]Decoder),
+	}
+	r.Register(definitions...)
+	return r
+}
+
+// Register adds packet definitions to the registry, replacing any existing
+// definition of the same packet with the same Since. Definitions in
+// StateTransfer are registered in StateLogin.
+func (r *Registry) Register(definitions ...PacketDefinition) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, definition := range definitions {
+		definition.State = definition.State.packetState()
+		key := packetKey{definition.Name, definition.State,
+			definition.Direction}
+		existing := r.definitions[key]
+
+		i := 0
+		for i < len(existing) && existing[i].Since < definition.Since {
+			i++
+		}
+
+		if i < len(existing) && existing[i].Since == definition.Since {
+			existing[i] = definition
+			continue
+		}
+
+		existing = append(existing, PacketDefinition{})
+		copy(existing[i+1:], existing[i:])
+		existing[i] = definition
+		r.definitions[key] = existing
+	}
+}
+
+// Load reads a JSON array of packet definitions, in the same format as the
+// bundled packets.json, and registers them.
+func (r *Registry) Load(rd io.Reader) error {
+	var definitions []PacketDefinition
+	if err := json.NewDecoder(rd).Decode(&definitions); err != nil {
+		return err
+	}
+
+	r.Register(definitions...)
+	return nil
+}
+
+// LoadFile is like Load, but reads the definitions from the file at path.
+func (r *Registry) LoadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return r.Load(file)
+}
+
+// SetDecoder sets the decoder of a packet for every protocol version.
+// Decoders are given the protocol number of the client, so they can handle
+// packets with layouts that differ between versions.
+func (r *Registry) SetDecoder(state State, direction Direction, name string,
+	decoder Decoder) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.decoders[packetKey{name, state.packetState(), direction}] = decoder
+}
+
+// definition returns the definition of the packet used by the protocol
+// number. The mutex must be held.
+func (r *Registry) definition(protocolNumber int,
+	key packetKey) (PacketDefinition, bool) {
+	definitions := r.definitions[key]
+	for i := len(definitions) - 1; i >= 0; i-- {
+		if versions.AtLeast(protocolNumber, definitions[i].Since) {
+			if definitions[i].ID < 0 {
+				return PacketDefinition{}, false
+			}
+
+			definition := definitions[i]
+			definition.Decode = r.decoders[key]
+			return definition, true
+		}
+	}
+
+	return PacketDefinition{}, false
+}
+
+// Packet returns the definition of the named packet used by the protocol
+// number, or false if the packet doesn't exist in that version.
+func (r *Registry) Packet(protocolNumber int, state State,
+	direction Direction, name string) (PacketDefinition, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.definition(protocolNumber,
+		packetKey{name, state.packetState(), direction})
+}
+
+// Lookup returns the definition of the packet with the ID used by the
+// protocol number, or false if there is none.
+func (r *Registry) Lookup(protocolNumber int, state State,
+	direction Direction, id int) (PacketDefinition, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	state = state.packetState()
+	for key := range r.definitions {
+		if key.state != state || key.direction != direction {
+			continue
+		}
+
+		definition, found := r.definition(protocolNumber, key)
+		if found && definition.ID == id {
+			return definition, true
+		}
+	}
+
+	return PacketDefinition{}, false
+}
+
+// ID returns the ID of the named packet used by the protocol number, or
+// false if the packet doesn't exist in that version.
+func (r *Registry) ID(protocolNumber int, state State, direction Direction,
+	name string) (int, bool) {
+	definition, found := r.Packet(protocolNumber, state, direction, name)
+	return definition.ID, found
+}
+
+// NewPacket returns a new packet starting with the ID of the named packet
+// used by the protocol number, to be written to a client.
+func (r *Registry) NewPacket(protocolNumber int, state State,
+	name string) (*Packet, error) {
+	id, found := r.ID(protocolNumber, state, Clientbound, name)
+	if !found {
+		return nil, fmt.Errorf("protocol: no %s packet %q for %s", state,
+			name, versions.Name(protocolNumber))
+	}
+
+	return NewPacketWithID(id), nil
+}
+
+// ReadPacket reads the ID of the packet from the packet stream and returns
+// its definition, with the fields of the packet decoded if it has a
+// decoder. An *UnknownPacketError is returned if the ID isn't defined.
+func (r *Registry) ReadPacket(ps PacketStream, protocolNumber int,
+	state State, direction Direction) (PacketDefinition, interface{}, error) {
+	id, err := ps.ReadVarInt()
+	if err != nil {
+		return PacketDefinition{}, nil, err
+	}
+
+	definition, found := r.Lookup(protocolNumber, state, direction, id)
+	if !found {
+		return PacketDefinition{}, nil, &UnknownPacketError{
+			ProtocolNumber: protocolNumber,
+			State:          state,
+			Direction:      direction,
+			ID:             id,
+		}
+	}
+
+	if definition.Decode == nil {
+		return definition, nil, nil
+	}
+
+	value, err := definition.Decode(ps.Stream, protocolNumber)
+	return definition, value, err
+}
+
+// Register adds packet definitions to the Default registry.
+func Register(definitions ...PacketDefinition) {
+	Default.Register(definitions...)
+}
+
+// Load reads a JSON array of packet definitions into the Default registry.
+func Load(rd io.Reader) error {
+	return Default.Load(rd)
+}
+
+// LoadFile reads a JSON array of packet definitions from the file at path
+// into the Default registry.
+func LoadFile(path string) error {
+	return Default.LoadFile(path)
+}
+
+// SetDecoder sets the decoder of a packet in the Default registry.
+func SetDecoder(state State, direction Direction, name string,
+	decoder Decoder) {
+	Default.SetDecoder(state, direction, name, decoder)
+}
+
+// Lookup returns the definition of the packet with the ID used by the
+// protocol number from the Default registry.
+func Lookup(protocolNumber int, state State, direction Direction,
+	id int) (PacketDefinition, bool) {
+	return Default.Lookup(protocolNumber, state, direction, id)
+}
+
+// ID returns the ID of the named packet used by the protocol number from
+// the Default registry.
+func ID(protocolNumber int, state State, direction Direction,
+	name string) (int, bool) {
+	return Default.ID(protocolNumber, state, direction, name)
+}
+
+// NewPacket returns a new packet starting with the ID of the named
+// clientbound packet from the Default registry.
+func NewPacket(protocolNumber int, state State, name string) (*Packet, error) {
+	return Default.NewPacket(protocolNumber, state, name)
+}
+
+// ReadPacket reads and decodes a packet using the Default registry.
+func ReadPacket(ps PacketStream, protocolNumber int, state State,
+	direction Direction) (PacketDefinition, interface{}, error) {
+	return Default.ReadPacket(ps, protocolNumber, state, direction)
+}
@@ -0,0 +1,236 @@
+package protocol
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestBundledPackets(t *testing.T) {
+	tests := []struct {
+		protocolNumber int
+		state          State
+		direction      Direction
+		name           string
+		id             int
+		found          bool
+	}{
+		{47, StateHandshaking, Serverbound, "handshake", 0, true},
+		{4, StateStatus, Clientbound, "pong_response", 1, true},
+		{47, StateLogin, Clientbound, "set_compression", 3, true},
+		{5, StateLogin, Clientbound, "set_compression", 0, false},
+		{763, StateLogin, Serverbound, "login_acknowledged", 0, false},
+		{764, StateLogin, Serverbound, "login_acknowledged", 3, true},
+		{765, StateLogin, Serverbound, "cookie_response", 0, false},
+		{766, StateLogin, Serverbound, "cookie_response", 4, true},
+		{766, StateTransfer, Clientbound, "cookie_request", 5, true},
+		{763, StateConfiguration, Clientbound, "disconnect", 0, false},
+		{764, StateConfiguration, Clientbound, "disconnect", 1, true},
+		{765, StateConfiguration, Clientbound, "disconnect", 1, true},
+		{766, StateConfiguration, Clientbound, "disconnect", 2, true},
+		{773, StateConfiguration, Clientbound, "disconnect", 2, true},
+		{764, StateConfiguration, Serverbound, "plugin_message", 1, true},
+		{766, StateConfiguration, Serverbound, "plugin_message", 2, true},
+		{764, StateConfiguration, Serverbound, "known_packs", 0, false},
+		{766, StateConfiguration, Serverbound, "known_packs", 7, true},
+		{766, StateConfiguration, Serverbound, "status_request", 0, false},
+	}
+
+	for _, test := range tests {
+		id, found := ID(test.protocolNumber, test.state, test.direction,
+			test.name)
+		if id != test.id && test.found || found != test.found {
+			t.Errorf("%d %s %s %s: ID = %d, %t, want %d, %t",
+				test.protocolNumber, test.state, test.direction, test.name,
+				id, found, test.id, test.found)
+		}
+
+		if !test.found {
+			continue
+		}
+
+		definition, found := Lookup(test.protocolNumber, test.state,
+			test.direction, test.id)
+		if !found || definition.Name != test.name {
+			t.Errorf("%d %s %s 0x%02X: Lookup = %q, %t, want %q",
+				test.protocolNumber, test.state, test.direction, test.id,
+				definition.Name, found, test.name)
+		}
+	}
+}
+
+func TestLookupMisses(t *testing.T) {
+	tests := []struct {
+		protocolNumber int
+		state          State
+		direction      Direction
+		id             int
+	}{
+		// login_acknowledged was added in 1.20.2.
+		{763, StateLogin, Serverbound, 3},
+		{764, StateLogin, Serverbound, 4},
+		{764, StateConfiguration, Serverbound, 7},
+		{766, StateConfiguration, Clientbound, 0x7F},
+		{773, StatePlay, Clientbound, 0},
+		{47, StateConfiguration, Serverbound, 0},
+	}
+
+	for _, test := range tests {
+		if definition, found := Lookup(test.protocolNumber, test.state,
+			test.direction, test.id); found {
+			t.Errorf("%d %s %s 0x%02X: Lookup = %q, want a miss",
+				test.protocolNumber, test.state, test.direction, test.id,
+				definition.Name)
+		}
+	}
+}
+
+func TestRegister(t *testing.T) {
+	r := NewRegistry([]PacketDefinition{
+		{Name: "test", State: StateLogin, Direction: Clientbound, Since: 0,
+			ID: 1},
+		{Name: "test", State: StateLogin, Direction: Clientbound, Since: 200,
+			ID: 2},
+		{Name: "test", State: StateLogin, Direction: Clientbound, Since: 100,
+			ID: 3},
+	})
+
+	// A definition with the same Since replaces the existing one, and
+	// transfer definitions are registered in the login state.
+	r.Register(PacketDefinition{Name: "test", State: StateTransfer,
+		Direction: Clientbound, Since: 200, ID: 4})
+	// An ID of -1 removes the packet.
+	r.Register(PacketDefinition{Name: "test", State: StateLogin,
+		Direction: Clientbound, Since: 300, ID: -1})
+
+	tests := []struct {
+		protocolNumber int
+		id             int
+		found          bool
+	}{
+		{0, 1, true},
+		{99, 1, true},
+		{100, 3, true},
+		{199, 3, true},
+		{200, 4, true},
+		{299, 4, true},
+		{300, 0, false},
+	}
+
+	for _, test := range tests {
+		for _, state := range []State{StateLogin, StateTransfer} {
+			id, found := r.ID(test.protocolNumber, state, Clientbound, "test")
+			if id != test.id && test.found || found != test.found {
+				t.Errorf("%d %s: ID = %d, %t, want %d, %t",
+					test.protocolNumber, state, id, found, test.id, test.found)
+			}
+		}
+	}
+
+	if _, found := r.ID(200, StateLogin, Serverbound, "test"); found {
+		t.Error("serverbound: expected no packet")
+	}
+
+	if _, found := r.Lookup(300, StateLogin, Clientbound, -1); found {
+		t.Error("removed: expected Lookup of -1 to miss")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	r := NewRegistry(nil)
+	err := r.Load(strings.NewReader(`[
+		{"name": "test", "state": "configuration",
+			"direction": "clientbound", "since": 764, "id": 5},
+		{"name": "test", "state": "Configuration",
+			"direction": "Clientbound", "since": 766, "id": 6}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for protocolNumber, expected := range map[int]int{764: 5, 765: 5,
+		766: 6} {
+		id, found := r.ID(protocolNumber, StateConfiguration, Clientbound,
+			"test")
+		if !found || id != expected {
+			t.Errorf("%d: ID = %d, %t, want %d", protocolNumber, id, found,
+				expected)
+		}
+	}
+
+	for _, invalid := range []string{
+		`{"name": "test"}`,
+		`[{"name": "test", "state": "unknown", "direction": "clientbound"}]`,
+		`[{"name": "test", "state": "login", "direction": "sideways"}]`,
+	} {
+		if err := r.Load(strings.NewReader(invalid)); err == nil {
+			t.Errorf("%s: expected an error", invalid)
+		}
+	}
+}
+
+func TestNewPacket(t *testing.T) {
+	packet, err := NewPacket(766, StateConfiguration, "disconnect")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer packet.Release()
+
+	if len(packet.Data) != 1 || packet.Data[0] != 2 {
+		t.Errorf("Data = %v, want [2]", packet.Data)
+	}
+
+	// Serverbound packets can't be created, and the configuration state
+	// doesn't exist before 1.20.2.
+	if _, err := NewPacket(766, StateConfiguration, "known_packs"); err == nil {
+		t.Error("serverbound: expected an error")
+	}
+
+	if _, err := NewPacket(763, StateConfiguration, "disconnect"); err == nil {
+		t.Error("763: expected an error")
+	}
+}
+
+func TestReadPacket(t *testing.T) {
+	r := NewRegistry([]PacketDefinition{
+		{Name: "test", State: StateLogin, Direction: Serverbound, Since: 0,
+			ID: 2},
+		{Name: "undecoded", State: StateLogin, Direction: Serverbound,
+			Since: 0, ID: 3},
+	})
+	r.SetDecoder(StateTransfer, Serverbound, "test",
+		func(s Stream, protocolNumber int) (interface{}, error) {
+			value, err := s.ReadVarInt()
+			return value + protocolNumber, err
+		})
+
+	definition, value, err := r.ReadPacket(NewSliceStream([]byte{2, 5}), 100,
+		StateLogin, Serverbound)
+	if err != nil || definition.Name != "test" || value != 105 {
+		t.Errorf("test: ReadPacket = %q, %v, %v", definition.Name, value, err)
+	}
+
+	definition, value, err = r.ReadPacket(NewSliceStream([]byte{3}), 100,
+		StateLogin, Serverbound)
+	if err != nil || definition.Name != "undecoded" || value != nil {
+		t.Errorf("undecoded: ReadPacket = %q, %v, %v", definition.Name, value,
+			err)
+	}
+
+	_, _, err = r.ReadPacket(NewSliceStream([]byte{4}), 100, StateLogin,
+		Serverbound)
+	var unknown *UnknownPacketError
+	if !errors.As(err, &unknown) || *unknown != (UnknownPacketError{
+		ProtocolNumber: 100,
+		State:          StateLogin,
+		Direction:      Serverbound,
+		ID:             4,
+	}) {
+		t.Errorf("unknown: error = %v", err)
+	}
+
+	if _, _, err := r.ReadPacket(NewSliceStream(nil), 100, StateLogin,
+		Serverbound); err == nil {
+		t.Error("empty: expected an error")
+	}
+}
@@ -3,19 +3,30 @@
 package protocol
 
 import (
+	"bufio"
+	"errors"
 	"io"
+	"sync"
 )
 
+// ErrReadOnly is returned when writing to a Stream created by
+// NewSliceStream.
+var ErrReadOnly = errors.New("protocol: stream is read only")
+
 // A Stream represents a two-way stream of bytes to and from the client.
 type Stream struct {
 	io.ReadWriter
+
+	// compression is set by SetCompression, and is nil if packets aren't
+	// compressed.
+	compression *compression
 }
 
 // A PacketStream is a subset of a Stream which is limited to being only able
 // to read a single packet from the stream.
 type PacketStream struct {
 	Stream
-	reader *io.LimitedReader
+	reader *packetReader
 }
 
 type readWriter struct {
@@ -23,45 +34,227 @@ type readWriter struct {
 	io.Writer
 }
 
+// packetReader reads up to the end of a packet from a stream, and writes
+// to writer.
+type packetReader struct {
+	stream    Stream
+	writer    io.Writer
+	remaining int64
+}
+
+func (r *packetReader) Read(data []byte) (int, error) {
+	if r.remaining <= 0 {
+		return 0, io.EOF
+	}
+
+	if int64(len(data)) > r.remaining {
+		data = data[:r.remaining]
+	}
+
+	n, err := r.stream.Read(data)
+	r.remaining -= int64(n)
+	return n, err
+}
+
+func (r *packetReader) ReadByte() (byte, error) {
+	if r.remaining <= 0 {
+		return 0, io.EOF
+	}
+
+	b, err := r.stream.ReadByte()
+	if err == nil {
+		r.remaining--
+	}
+
+	return b, err
+}
+
+func (r *packetReader) Write(data []byte) (int, error) {
+	return r.writer.Write(data)
+}
+
+// sliceReader reads from a byte slice.
+type sliceReader struct {
+	data []byte
+}
+
+func (r *sliceReader) Read(data []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, io.EOF
+	}
+
+	n := copy(data, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func (r *sliceReader) ReadByte() (byte, error) {
+	if len(r.data) == 0 {
+		return 0, io.EOF
+	}
+
+	b := r.data[0]
+	r.data = r.data[1:]
+	return b, nil
+}
+
+func (r *sliceReader) Write(data []byte) (int, error) {
+	return 0, ErrReadOnly
+}
+
+// bufferSize is the size of the buffers used by buffered streams, which
+// fits most packets sent before a player is forwarded.
+const bufferSize = 4096
+
+var readerPool = sync.Pool{
+	New: func() interface{} {
+		return bufio.NewReaderSize(nil, bufferSize)
+	},
+}
+
+// bufferedReadWriter reads through a pooled buffer, and writes directly.
+type bufferedReadWriter struct {
+	*bufio.Reader
+	io.Writer
+}
+
 // ExhaustPacket reads all the remaining data from the PacketStream, so the
 // cursor of the Stream is at the start of the next packet.
 func (s PacketStream) ExhaustPacket() (int, error) {
-	if s.reader.N == 0 {
+	bytesRemaining := int(s.reader.remaining)
+	if bytesRemaining == 0 {
 		return 0, nil
 	}
 
-	bytesRemaining := int(s.reader.N)
-
-	return bytesRemaining, s.ReadFull(make([]byte, bytesRemaining))
+	_, err := io.CopyN(io.Discard, s.reader, s.reader.remaining)
+	return bytesRemaining, err
 }
 
 // GetRemainingBytes returns the number of remaining bytes in the PacketStream
 // for the current packet.
 func (s PacketStream) GetRemainingBytes() int {
-	return int(s.reader.N)
+	return int(s.reader.remaining)
+}
+
+// MaxPacketSize is the largest packet that can be read, which is the most
+// that a 3 byte VarInt can hold, as in the vanilla server.
+const MaxPacketSize = 2097151
+
+// MaxPacketSizes limits the size of packets that are read in each state, in
+// bytes including the packet ID. States that aren't in the map are limited
+// to MaxPacketSize. It should only be changed before any connections are
+// handled.
+var MaxPacketSizes = map[State]int{
+	// The handshake has a protocol number, server address of up to 255
+	// characters, port and next state.
+	StateHandshaking: 1 + MaxVarIntSize + 2 + 255*4 + 2 + MaxVarIntSize,
+	// The status request is empty, and the ping request has a long.
+	StateStatus: 1 + 8,
+}
+
+// MaxPacketSizeFor returns the largest packet that can be read in the
+// state, from MaxPacketSizes.
+func MaxPacketSizeFor(state State) int {
+	if size, found := MaxPacketSizes[state.packetState()]; found {
+		return size
+	}
+
+	return MaxPacketSize
 }
 
 // GetPacketStream reads the next VarInt, and creates a PacketStream limited
-// by the VarInt representing the entirety of the packet.
+// by the VarInt representing the entirety of the packet. ErrPacketTooLarge
+// is returned if the packet is larger than MaxPacketSize.
 func (s Stream) GetPacketStream() (PacketStream, int, error) {
+	return s.GetPacketStreamLimit(MaxPacketSize)
+}
+
+// GetPacketStreamLimit is like GetPacketStream, but returns
+// ErrPacketTooLarge if the packet is larger than limit bytes. If
+// compression is enabled, limit applies to the compressed packet. See
+// MaxPacketSizeFor.
+func (s Stream) GetPacketStreamLimit(limit int) (PacketStream, int, error) {
 	length, err := s.ReadVarInt()
 	if err != nil {
 		return PacketStream{}, 0, err
 	}
 
-	if length == 0 {
+	if length <= 0 {
 		return PacketStream{}, 0, ErrInvalidData
 	}
 
-	limitedReader := &io.LimitedReader{R: s, N: int64(length)}
+	if length > limit {
+		return PacketStream{}, 0, ErrPacketTooLarge
+	}
+
+	reader := &packetReader{stream: s, writer: s, remaining: int64(length)}
+	if s.compression != nil {
+		return s.readCompressed(reader, limit)
+	}
+
+	return PacketStream{Stream{reader, s.compression}, reader}, length, nil
+}
+
+// NewSliceStream creates a PacketStream that reads from data, for decoding
+// a packet that has already been read, such as one that was decompressed.
+// Writes to it return ErrReadOnly.
+func NewSliceStream(data []byte) PacketStream {
+	source := &sliceReader{data}
+	reader := &packetReader{
+		stream:    Stream{ReadWriter: source},
+		writer:    source,
+		remaining: int64(len(data)),
+	}
+	return PacketStream{Stream{ReadWriter: reader}, reader}
+}
+
+// NewBufferedStream creates a new Stream from a io.ReadWriter, that reads
+// through a pooled buffer so that reading small values doesn't read from
+// readWriter each time. Data that has been buffered but not read yet can be
+// retrieved with Buffered, and Release returns the buffer to the pool once
+// the Stream is no longer used.
+func NewBufferedStream(readWriter io.ReadWriter) Stream {
+	reader := readerPool.Get().(*bufio.Reader)
+	reader.Reset(readWriter)
+	return Stream{ReadWriter: bufferedReadWriter{reader, readWriter}}
+}
+
+// Buffered returns the data that has been read ahead by a buffered Stream,
+// which must be passed on when the underlying connection is read from
+// directly. The data is only valid until the next read from the Stream, and
+// UnreadByte can't be called until then. It returns nil for other streams.
+func (s Stream) Buffered() []byte {
+	buffered, ok := s.ReadWriter.(bufferedReadWriter)
+	if !ok || buffered.Reader.Buffered() == 0 {
+		return nil
+	}
+
+	data, _ := buffered.Reader.Peek(buffered.Reader.Buffered())
+	return data
+}
+
+// Release returns the buffer of a buffered Stream to the pool, after which
+// the Stream must not be read from. It does nothing for other streams.
+func (s Stream) Release() {
+	if buffered, ok := s.ReadWriter.(bufferedReadWriter); ok {
+		buffered.Reader.Reset(nil)
+		readerPool.Put(buffered.Reader)
+	}
+}
+
+// UnreadByte unreads the last byte read from a buffered Stream, so that it
+// is read again.
+func (s Stream) UnreadByte() error {
+	if scanner, ok := s.ReadWriter.(io.ByteScanner); ok {
+		return scanner.UnreadByte()
+	}
 
-	return PacketStream{Stream{readWriter{limitedReader, s}}, limitedReader},
-		length, nil
+	return errors.New("protocol: can't unread from unbuffered stream")
 }
 
 // NewStream creates a new Stream from a io.ReadWriter such as from a net.Conn
 func NewStream(readWriter io.ReadWriter) Stream {
-	return Stream{readWriter}
+	return Stream{ReadWriter: readWriter}
 }
 
 // DecodeReadFull returns decoded (little endian) data of len(data), or what's
@@ -91,15 +284,39 @@ func (s Stream) ReadFull(data []byte) error {
 }
 
 // WritePacket writes the length of the Packet as a VarInt, and the Packet's
-// Data (payload) to the stream.
+// Data (payload) to the stream in a single write. The length is written in
+// the space reserved in front of the Data, so the Data isn't copied unless
+// it was replaced. The Packet is compressed if compression is enabled, see
+// SetCompression.
 func (s Stream) WritePacket(p *Packet) error {
-	lengthPacket := &Packet{}
-	lengthPacket.WriteVarInt(len(p.Data))
+	if s.compression != nil {
+		return s.writeCompressed(p)
+	}
 
-	_, err := s.Write(append(lengthPacket.Data, p.Data...))
-	if err != nil {
+	return s.writeFrame(p)
+}
+
+// writeFrame writes the Packet prefixed with its length, and the prefix
+// bytes that follow the length.
+func (s Stream) writeFrame(p *Packet, prefix ...byte) error {
+	var header [headerSize]byte
+	frameHeader := appendVarInt(header[:0], int64(len(prefix)+len(p.Data)))
+	frameHeader = append(frameHeader, prefix...)
+
+	if p.framed() && len(frameHeader) <= headerSize {
+		start := headerSize - len(frameHeader)
+		frame := p.buffer[start : headerSize+len(p.Data)]
+		copy(frame, frameHeader)
+		_, err := s.Write(frame)
 		return err
 	}
 
-	return nil
+	frame := pooledPacket()
+	defer frame.Release()
+	frame.grow(len(frameHeader) + len(p.Data))
+	frame.Write(frameHeader)
+	frame.Write(p.Data)
+
+	_, err := s.Write(frame.Data)
+	return err
 }
@@ -0,0 +1,331 @@
+package protocol
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/1lann/beacon/versions"
+	"math"
+	"strings"
+)
+
+// A UUID is a 128-bit UUID, sent as two big endian longs.
+type UUID [16]byte
+
+// ParseUUID parses a UUID in its hexadecimal form, with or without dashes.
+func ParseUUID(s string) (UUID, error) {
+	var uuid UUID
+	data, err := hex.DecodeString(strings.Replace(s, "-", "", -1))
+	if err != nil || len(data) != len(uuid) {
+		return UUID{}, fmt.Errorf("protocol: invalid UUID %q", s)
+	}
+
+	copy(uuid[:], data)
+	return uuid, nil
+}
+
+// String returns the UUID in its hexadecimal form, with dashes.
+func (u UUID) String() string {
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10],
+		u[10:16])
+}
+
+// MarshalPacket implements Marshaler.
+func (u UUID) MarshalPacket(p *Packet) error {
+	p.WriteUUID(u)
+	return nil
+}
+
+// UnmarshalPacket implements Unmarshaler.
+func (u *UUID) UnmarshalPacket(s Stream) error {
+	var err error
+	*u, err = s.ReadUUID()
+	return err
+}
+
+// ReadUUID reads the next 16 bytes as a UUID from the stream.
+func (s Stream) ReadUUID() (UUID, error) {
+	var uuid UUID
+	if err := s.ReadFull(uuid[:]); err != nil {
+		return UUID{}, err
+	}
+
+	return uuid, nil
+}
+
+// WriteUUID writes a UUID to the Packet.
+func (p *Packet) WriteUUID(uuid UUID) {
+	p.grow(len(uuid))
+	p.Data = append(p.Data, uuid[:]...)
+}
+
+// PositionProtocol is the protocol number of 1.14, which changed the order
+// of the coordinates in a packed Position.
+const PositionProtocol = 477
+
+// A Position is the position of a block, packed into a long with 26 bits
+// for X and Z, and 12 bits for Y.
+type Position struct {
+	X, Y, Z int
+}
+
+// Pack returns the position packed in the layout used by the protocol
+// number.
+func (pos Position) Pack(protocolNumber int) int64 {
+	x := uint64(pos.X) & 0x3FFFFFF
+	y := uint64(pos.Y) & 0xFFF
+	z := uint64(pos.Z) & 0x3FFFFFF
+	if !versions.AtLeast(protocolNumber, PositionProtocol) {
+		return int64(x<<38 | y<<26 | z)
+	}
+
+	return int64(x<<38 | z<<12 | y)
+}
+
+// UnpackPosition returns the position packed in the layout used by the
+// protocol number.
+func UnpackPosition(packed int64, protocolNumber int) Position {
+	// The coordinates are sign extended by shifting them to the top of the
+	// long, then back down.
+	if !versions.AtLeast(protocolNumber, PositionProtocol) {
+		return Position{
+			X: int(packed >> 38),
+			Y: int(packed << 26 >> 52),
+			Z: int(packed << 38 >> 38),
+		}
+	}
+
+	return Position{
+		X: int(packed >> 38),
+		Y: int(packed << 52 >> 52),
+		Z: int(packed << 26 >> 38),
+	}
+}
+
+// MarshalPacket implements Marshaler, using the layout of the current
+// protocol.
+func (pos Position) MarshalPacket(p *Packet) error {
+	p.WritePosition(pos, PositionProtocol)
+	return nil
+}
+
+// UnmarshalPacket implements Unmarshaler, using the layout of the current
+// protocol.
+func (pos *Position) UnmarshalPacket(s Stream) error {
+	var err error
+	*pos, err = s.ReadPosition(PositionProtocol)
+	return err
+}
+
+// ReadPosition reads the next 8 bytes as a Position packed in the layout
+// used by the protocol number.
+func (s Stream) ReadPosition(protocolNumber int) (Position, error) {
+	packed, err := s.ReadInt64()
+	if err != nil {
+		return Position{}, err
+	}
+
+	return UnpackPosition(packed, protocolNumber), nil
+}
+
+// WritePosition writes a Position packed in the layout used by the
+// protocol number to the Packet.
+func (p *Packet) WritePosition(pos Position, protocolNumber int) {
+	p.WriteInt64(pos.Pack(protocolNumber))
+}
+
+// An Angle is a rotation in steps of 1/256 of a full turn.
+type Angle uint8
+
+// AngleFromDegrees returns the closest Angle to the rotation in degrees.
+func AngleFromDegrees(degrees float64) Angle {
+	return Angle(int64(math.Round(degrees*256/360)) & 0xFF)
+}
+
+// Degrees returns the angle in degrees, from 0 up to 360.
+func (a Angle) Degrees() float64 {
+	return float64(a) * 360 / 256
+}
+
+// ReadAngle reads the next byte as an Angle from the stream.
+func (s Stream) ReadAngle() (Angle, error) {
+	b, err := s.ReadByte()
+	return Angle(b), err
+}
+
+// WriteAngle writes an Angle to the Packet.
+func (p *Packet) WriteAngle(angle Angle) {
+	p.grow(1)
+	p.Data = append(p.Data, byte(angle))
+}
+
+// DefaultNamespace is the namespace of identifiers that don't have one.
+const DefaultNamespace = "minecraft"
+
+// An Identifier is a namespaced location, such as "minecraft:stone", that
+// names resources and registry entries.
+type Identifier string
+
+// ParseIdentifier validates an identifier, adding the default namespace if
+// it doesn't have one. Namespaces may contain lowercase letters, digits,
+// and the characters "._-", and paths may also contain "/".
+func ParseIdentifier(s string) (Identifier, error) {
+	namespace, path := DefaultNamespace, s
+	if i := strings.IndexByte(s, ':'); i >= 0 {
+		namespace, path = s[:i], s[i+1:]
+	}
+
+	if namespace == "" || path == "" ||
+		!validIdentifier(namespace, false) || !validIdentifier(path, true) {
+		return "", fmt.Errorf("protocol: invalid identifier %q", s)
+	}
+
+	return Identifier(namespace + ":" + path), nil
+}
+
+// validIdentifier returns whether the namespace or path only contains the
+// characters allowed in it.
+func validIdentifier(s string, path bool) bool {
+	for _, c := range s {
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9',
+			c == '.', c == '_', c == '-', path && c == '/':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// Namespace returns the namespace of the identifier.
+func (id Identifier) Namespace() string {
+	if i := strings.IndexByte(string(id), ':'); i >= 0 {
+		return string(id[:i])
+	}
+
+	return DefaultNamespace
+}
+
+// Path returns the path of the identifier, after its namespace.
+func (id Identifier) Path() string {
+	if i := strings.IndexByte(string(id), ':'); i >= 0 {
+		return string(id[i+1:])
+	}
+
+	return string(id)
+}
+
+// MarshalPacket implements Marshaler.
+func (id Identifier) MarshalPacket(p *Packet) error {
+	p.WriteIdentifier(id)
+	return nil
+}
+
+// UnmarshalPacket implements Unmarshaler.
+func (id *Identifier) UnmarshalPacket(s Stream) error {
+	var err error
+	*id, err = s.ReadIdentifier()
+	return err
+}
+
+// ReadIdentifier reads a string as an Identifier from the stream, and
+// validates it.
+func (s Stream) ReadIdentifier() (Identifier, error) {
+	value, err := s.ReadString()
+	if err != nil {
+		return "", err
+	}
+
+	return ParseIdentifier(value)
+}
+
+// WriteIdentifier writes an Identifier to the Packet.
+func (p *Packet) WriteIdentifier(id Identifier) {
+	p.WriteString(string(id))
+}
+
+// A BitSet is a set of bits, stored in longs from the least significant
+// bit of the first long.
+type BitSet []int64
+
+// NewBitSet returns a BitSet that can hold n bits.
+func NewBitSet(n int) BitSet {
+	return make(BitSet, (n+63)/64)
+}
+
+// Get returns whether the bit at index i is set.
+func (b BitSet) Get(i int) bool {
+	if i < 0 || i/64 >= len(b) {
+		return false
+	}
+
+	return b[i/64]&(1<<uint(i%64)) != 0
+}
+
+// Set sets the bit at index i, which must be within the set.
+func (b BitSet) Set(i int, value bool) {
+	if value {
+		b[i/64] |= 1 << uint(i%64)
+	} else {
+		b[i/64] &^= 1 << uint(i%64)
+	}
+}
+
+// MarshalPacket implements Marshaler.
+func (b BitSet) MarshalPacket(p *Packet) error {
+	p.WriteBitSet(b)
+	return nil
+}
+
+// UnmarshalPacket implements Unmarshaler.
+func (b *BitSet) UnmarshalPacket(s Stream) error {
+	var err error
+	*b, err = s.ReadBitSet()
+	return err
+}
+
+// ReadBitSet reads a BitSet prefixed with its number of longs as a VarInt
+// from the stream.
+func (s Stream) ReadBitSet() (BitSet, error) {
+	return ReadArray(s, 0, func(s Stream) (int64, error) {
+		return s.ReadInt64()
+	})
+}
+
+// WriteBitSet writes a BitSet prefixed with its number of longs as a VarInt
+// to the Packet.
+func (p *Packet) WriteBitSet(b BitSet) {
+	p.WriteVarInt(len(b))
+	for _, value := range b {
+		p.WriteInt64(value)
+	}
+}
+
+// ReadFixedBitSet reads a BitSet of n bits, which isn't prefixed with its
+// length, from the stream.
+func (s Stream) ReadFixedBitSet(n int) (BitSet, error) {
+	data := make([]byte, (n+7)/8)
+	if err := s.ReadFull(data); err != nil {
+		return nil, err
+	}
+
+	b := NewBitSet(n)
+	for i, value := range data {
+		b[i/8] |= int64(value) << uint(i%8*8)
+	}
+
+	return b, nil
+}
+
+// WriteFixedBitSet writes the first n bits of a BitSet to the Packet,
+// without its length.
+func (p *Packet) WriteFixedBitSet(b BitSet, n int) {
+	p.grow((n + 7) / 8)
+	for i := 0; i < (n+7)/8; i++ {
+		var value byte
+		if i/8 < len(b) {
+			value = byte(b[i/8] >> uint(i%8*8))
+		}
+		p.Data = append(p.Data, value)
+	}
+}
@@ -2,36 +2,120 @@ package protocol
 
 import (
 	"encoding/binary"
+	"math"
+	"sync"
 )
 
 // A Packet represents a packet in the Minecraft protocol that is to be sent
 // to the client. It is not used for receiving or reading packets.
 type Packet struct {
 	Data []byte
+
+	// buffer holds Data after headerSize bytes that are reserved for the
+	// length of the packet, so that WritePacket can frame it in place.
+	buffer []byte
+}
+
+// headerSize is the number of bytes reserved in front of a Packet's Data
+// for its length, which is the maximum length of a VarInt, and the data
+// length of an uncompressed packet when compression is enabled.
+const headerSize = MaxVarIntSize + 1
+
+// The sizes of the buffers of pooled packets. Packets that grow larger than
+// maxPooledSize aren't returned to the pool.
+const (
+	minPacketSize = 256
+	maxPooledSize = 64 * 1024
+)
+
+var packetPool = sync.Pool{
+	New: func() interface{} {
+		return &Packet{}
+	},
 }
 
 // NewPacketWithID returns a new Packet with the Id written to the start
-// of the Packet.
+// of the Packet. The Packet may be reused from a pool, see Release.
 func NewPacketWithID(id int) *Packet {
-	p := &Packet{}
+	p := pooledPacket()
 	p.WriteVarInt(id)
 	return p
 }
 
+// pooledPacket returns an empty Packet from the pool.
+func pooledPacket() *Packet {
+	p := packetPool.Get().(*Packet)
+	if p.buffer != nil {
+		p.Data = p.buffer[headerSize:headerSize]
+	}
+
+	return p
+}
+
+// Release returns the Packet to a pool to be reused by NewPacketWithID.
+// Neither the Packet nor its Data may be used after it's released. Packets
+// whose Data was replaced aren't pooled, and releasing a Packet again has
+// no effect, so that it isn't handed out twice.
+func (p *Packet) Release() {
+	if !p.framed() || cap(p.buffer) > maxPooledSize {
+		return
+	}
+
+	// Data is restored by pooledPacket, until then the Packet isn't
+	// framed.
+	p.Data = nil
+	packetPool.Put(p)
+}
+
+// framed returns whether Data is still held in the buffer after the space
+// reserved for the header.
+func (p *Packet) framed() bool {
+	if p.buffer == nil || cap(p.Data) != cap(p.buffer)-headerSize {
+		return false
+	}
+
+	return &p.Data[:1][0] == &p.buffer[headerSize : headerSize+1][0]
+}
+
+// grow makes room for n more bytes in Data, keeping the space reserved for
+// the header in front of it. Packets whose Data was replaced are left to
+// grow by append.
+func (p *Packet) grow(n int) {
+	if len(p.Data)+n <= cap(p.Data) {
+		return
+	}
+
+	if !p.framed() && (p.buffer != nil || len(p.Data) > 0) {
+		return
+	}
+
+	size := 2*cap(p.Data) + n
+	if size < minPacketSize {
+		size = minPacketSize
+	}
+
+	buffer := make([]byte, headerSize, headerSize+size)
+	p.Data = append(buffer[headerSize:], p.Data...)
+	p.buffer = buffer
+}
+
 // Write writes arbitrary bytes to the Packet.
 func (p *Packet) Write(data []byte) (int, error) {
+	p.grow(len(data))
 	p.Data = append(p.Data, data...)
 	return len(data), nil
 }
 
 // WriteByte writes a single byte to the Packet.
 func (p *Packet) WriteByte(data byte) error {
+	p.grow(1)
 	p.Data = append(p.Data, data)
 	return nil
 }
 
 // WriteBoolean writes a boolean to the Packet.
 func (p *Packet) WriteBoolean(data bool) {
+	p.grow(1)
 	if data {
 		p.Data = append(p.Data, 0x01)
 	} else {
@@ -41,73 +125,95 @@ func (p *Packet) WriteBoolean(data bool) {
 
 // WriteSignedByte writes an int8 to the Packet.
 func (p *Packet) WriteSignedByte(data int8) {
+	p.grow(1)
 	p.Data = append(p.Data, byte(data))
 }
 
 // WriteInt16 writes an int16 (a short) to the Packet.
 func (p *Packet) WriteInt16(data int16) {
-	result := make([]byte, 2)
-	binary.BigEndian.PutUint16(result, uint16(data))
-	p.Data = append(p.Data, result...)
+	p.grow(2)
+	p.Data = binary.BigEndian.AppendUint16(p.Data, uint16(data))
 }
 
 // WriteUInt16 writes an uint16 (an unsigned short) to the Packet.
 func (p *Packet) WriteUInt16(data uint16) {
-	result := make([]byte, 2)
-	binary.BigEndian.PutUint16(result, data)
-	p.Data = append(p.Data, result...)
+	p.grow(2)
+	p.Data = binary.BigEndian.AppendUint16(p.Data, data)
 }
 
 // WriteInt32 writes an int32 to the Packet.
 func (p *Packet) WriteInt32(data int32) {
-	result := make([]byte, 4)
-	binary.BigEndian.PutUint32(result, uint32(data))
-	p.Data = append(p.Data, result...)
+	p.grow(4)
+	p.Data = binary.BigEndian.AppendUint32(p.Data, uint32(data))
 }
 
 // WriteInt64 writes an int64 (a long) to the Packet.
 func (p *Packet) WriteInt64(data int64) {
-	result := make([]byte, 8)
-	binary.BigEndian.PutUint64(result, uint64(data))
-	p.Data = append(p.Data, result...)
+	p.grow(8)
+	p.Data = binary.BigEndian.AppendUint64(p.Data, uint64(data))
 }
 
 // WriteFloat32 writes a float32 (a single-precision float) to the Packet.
 func (p *Packet) WriteFloat32(data float32) {
-	binary.Write(p, binary.BigEndian, data)
-	return
+	p.WriteInt32(int32(math.Float32bits(data)))
 }
 
 // WriteFloat64 writes a float64 (a double-precision float) to the Packet.
 func (p *Packet) WriteFloat64(data float64) {
-	binary.Write(p, binary.BigEndian, data)
-	return
+	p.WriteInt64(int64(math.Float64bits(data)))
 }
 
 // WriteString writes a VarInt which is the length of the string, and the
 // string itself to the Packet.
 func (p *Packet) WriteString(data string) {
 	p.WriteVarInt(len(data))
-	p.Data = append(p.Data, []byte(data)...)
+	p.grow(len(data))
+	p.Data = append(p.Data, data...)
+}
+
+// WriteByteArray writes a VarInt which is the length of the byte array, and
+// the byte array itself to the Packet.
+func (p *Packet) WriteByteArray(data []byte) {
+	p.WriteVarInt(len(data))
+	p.grow(len(data))
+	p.Data = append(p.Data, data...)
+}
+
+// WriteFixedPoint32 writes a float64 as a fixed-point int32 with 5
+// fractional bits to the Packet.
+func (p *Packet) WriteFixedPoint32(data float64) {
+	p.WriteInt32(int32(math.Floor(data * 32)))
+}
+
+// WriteFixedPoint8 writes a float64 as a fixed-point byte with 5 fractional
+// bits to the Packet.
+func (p *Packet) WriteFixedPoint8(data float64) {
+	p.WriteSignedByte(int8(math.Floor(data * 32)))
 }
 
-// WriteVarInt writes an int as a VarInt to the Packet.
+// WriteVarInt writes an int as a VarInt to the Packet. VarInts hold 32-bit
+// integers, so negative values take MaxVarIntSize bytes.
 func (p *Packet) WriteVarInt(data int) {
-	p.WriteVarInt64(int64(data))
+	p.WriteVarInt64(int64(uint32(data)))
 }
 
-// WriteVarInt64 writes an int64 as a VarInt to the Packet.
+// WriteVarInt64 writes an int64 as a VarLong to the Packet.
+func (p *Packet) WriteVarInt64(data int64) {
+	p.grow(10)
+	p.Data = appendVarInt(p.Data, data)
+}
+
+// appendVarInt appends an int64 as a VarInt to data.
 //
 // This code is taken from thinkofdeath's steven
 // (github.com/thinkofdeath/steven).
-func (p *Packet) WriteVarInt64(data int64) {
-	ui := uint64(data)
+func appendVarInt(data []byte, value int64) []byte {
+	ui := uint64(value)
 	for {
 		if (ui & ^uint64(0x7F)) == 0 {
-			p.Data = append(p.Data, byte(ui))
-			return
+			return append(data, byte(ui))
 		}
-		p.Data = append(p.Data, byte((ui&0x7F)|0x80))
+		data = append(data, byte((ui&0x7F)|0x80))
 		ui >>= 7
 	}
 }
@@ -0,0 +1,142 @@
+package protocol
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPacketHeader(t *testing.T) {
+	p := NewPacketWithID(0x12)
+	defer p.Release()
+
+	if !p.framed() || len(p.buffer) != headerSize ||
+		cap(p.Data) != cap(p.buffer)-headerSize {
+		t.Fatalf("new packet isn't framed: %d byte buffer, Data cap %d",
+			len(p.buffer), cap(p.Data))
+	}
+
+	// Writing past the capacity of the buffer grows it, keeping the space
+	// reserved for the header.
+	data := bytes.Repeat([]byte{0xAB}, minPacketSize*3)
+	p.Write(data)
+	p.WriteInt32(-1)
+
+	if !p.framed() {
+		t.Error("grown packet isn't framed")
+	}
+
+	expected := append(append([]byte{0x12}, data...), 0xFF, 0xFF, 0xFF, 0xFF)
+	if !bytes.Equal(p.Data, expected) {
+		t.Errorf("Data = %d bytes, want %d", len(p.Data), len(expected))
+	}
+
+	// Packets whose Data was replaced grow by append instead.
+	p.Data = []byte{0x12}
+	if p.framed() {
+		t.Error("packet with replaced Data is framed")
+	}
+
+	p.Write(data)
+	if !bytes.Equal(p.Data, append([]byte{0x12}, data...)) {
+		t.Errorf("replaced Data = %d bytes, want %d", len(p.Data),
+			len(data)+1)
+	}
+
+	// A zero Packet is framed once it's written to.
+	var zero Packet
+	zero.WriteByte(1)
+	if !zero.framed() {
+		t.Error("zero packet isn't framed")
+	}
+}
+
+func TestWritePacketFrame(t *testing.T) {
+	tests := []struct {
+		length int
+		header []byte
+	}{
+		{1, []byte{0x01}},
+		{127, []byte{0x7F}},
+		{128, []byte{0x80, 0x01}},
+		{16383, []byte{0xFF, 0x7F}},
+		{16384, []byte{0x80, 0x80, 0x01}},
+		{MaxPacketSize, []byte{0xFF, 0xFF, 0x7F}},
+	}
+
+	for _, test := range tests {
+		for _, replaced := range []bool{false, true} {
+			p := NewPacketWithID(0x00)
+			p.Write(bytes.Repeat([]byte{0xCD}, test.length-1))
+			if replaced {
+				p.Data = append([]byte(nil), p.Data...)
+			}
+			payload := append([]byte(nil), p.Data...)
+
+			var buf bytes.Buffer
+			if err := NewStream(&buf).WritePacket(p); err != nil {
+				t.Fatal(err)
+			}
+			p.Release()
+
+			frame := buf.Bytes()
+			if !bytes.HasPrefix(frame, test.header) ||
+				!bytes.Equal(frame[len(test.header):], payload) {
+				t.Errorf("%d bytes, replaced %t: frame starts with % x, "+
+					"%d bytes long", test.length, replaced,
+					frame[:len(test.header)], len(frame))
+			}
+
+			ps, length, err := NewStream(&buf).GetPacketStream()
+			if err != nil || length != test.length {
+				t.Errorf("%d bytes, replaced %t: read %d, %v", test.length,
+					replaced, length, err)
+				continue
+			}
+			ps.ExhaustPacket()
+		}
+	}
+}
+
+func TestPacketRelease(t *testing.T) {
+	p := NewPacketWithID(0x01)
+	p.WriteString("first")
+	p.Release()
+
+	// Releasing a packet again doesn't return it to the pool twice, which
+	// would hand it out to two callers.
+	p.Release()
+	first, second := NewPacketWithID(0x02), NewPacketWithID(0x03)
+	if first == second {
+		t.Fatal("released packet was handed out twice")
+	}
+
+	for _, reused := range []*Packet{first, second} {
+		if reused.Data[0] != 0x02 && reused.Data[0] != 0x03 ||
+			len(reused.Data) != 1 || !reused.framed() {
+			t.Errorf("reused packet Data = % x", reused.Data)
+		}
+	}
+	first.Release()
+	second.Release()
+
+	// Packets whose Data was replaced aren't pooled, as the caller may
+	// still reference their buffer.
+	p = NewPacketWithID(0x01)
+	held := p.Data
+	p.Data = []byte{0x01}
+	p.Release()
+	q := NewPacketWithID(0x04)
+	q.WriteString("overwritten")
+	if q == p || held[0] != 0x01 {
+		t.Errorf("packet with replaced Data was reused, held = % x", held)
+	}
+	q.Release()
+
+	// Packets that grew too large aren't pooled.
+	p = NewPacketWithID(0x01)
+	p.Write(make([]byte, maxPooledSize))
+	p.Release()
+	if q := NewPacketWithID(0x01); q == p || cap(q.buffer) > maxPooledSize {
+		t.Error("large packet was pooled")
+	}
+}
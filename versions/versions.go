@@ -0,0 +1,226 @@
+// Package versions is a registry of Minecraft protocol version numbers and
+// the releases they correspond to.
+//
+// The default registry is loaded from the bundled versions.json, and can be
+// extended or overridden at runtime with Load or Register.
+package versions
+
+import (
+	_ "embed"
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// SnapshotBit is set on the protocol numbers of snapshots released after
+// 1.16.4. Protocol numbers with this bit set are considered to be newer than
+// every release.
+const SnapshotBit = 0x40000000
+
+// Future is the release name returned for protocol numbers newer than any
+// release in a registry.
+const Future = "future"
+
+//go:embed versions.json
+var bundled []byte
+
+// Release describes a protocol version number and the name of the release
+// (or snapshot) it belongs to. If multiple releases share a protocol number,
+// Name is the latest of them.
+type Release struct {
+	Protocol int    `json:"protocol"`
+	Name     string `json:"name"`
+	Snapshot bool   `json:"snapshot,omitempty"`
+}
+
+// A Registry maps protocol version numbers to releases. It is safe for
+// concurrent use.
+type Registry struct {
+	mutex    sync.RWMutex
+	releases []Release
+}
+
+// Default is the registry used by the package level functions, loaded from
+// the bundled versions.json.
+var Default = NewRegistry(nil)
+
+func init() {
+	var releases []Release
+	if err := json.Unmarshal(bundled, &releases); err != nil {
+		panic("versions: invalid bundled versions.json: " + err.Error())
+	}
+
+	Default.Register(releases...)
+}
+
+// NewRegistry returns a new registry containing the given releases.
+func NewRegistry(releases []Release) *Registry {
+	r := &Registry{}
+	r.Register(releases...)
+	return r
+}
+
+// Register adds releases to the registry, replacing any existing releases
+// with the same protocol number.
+func (r *Registry) Register(releases ...Release) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, release := range releases {
+		i := sort.Search(len(r.releases), func(i int) bool {
+			return r.releases[i].Protocol >= release.Protocol
+		})
+
+		if i < len(r.releases) && r.releases[i].Protocol == release.Protocol {
+			r.releases[i] = release
+			continue
+		}
+
+		r.releases = append(r.releases, Release{})
+		copy(r.releases[i+1:], r.releases[i:])
+		r.releases[i] = release
+	}
+}
+
+// Load reads a JSON array of releases, in the same format as the bundled
+// versions.json, and registers them.
+func (r *Registry) Load(rd io.Reader) error {
+	var releases []Release
+	if err := json.NewDecoder(rd).Decode(&releases); err != nil {
+		return err
+	}
+
+	r.Register(releases...)
+	return nil
+}
+
+// LoadFile is like Load, but reads the releases from the file at path.
+func (r *Registry) LoadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return r.Load(file)
+}
+
+// Lookup returns the release with the exact given protocol number.
+func (r *Registry) Lookup(protocolNumber int) (Release, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	i := r.search(protocolNumber)
+	if i < len(r.releases) && r.releases[i].Protocol == protocolNumber {
+		return r.releases[i], true
+	}
+
+	return Release{}, false
+}
+
+// Name returns the release name for a protocol version number. Unknown
+// protocol numbers are named after the first release that follows them,
+// or Future if there is none.
+func (r *Registry) Name(protocolNumber int) string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	i := r.search(protocolNumber)
+	if i < len(r.releases) {
+		return r.releases[i].Name
+	}
+
+	if protocolNumber&SnapshotBit != 0 {
+		return "snapshot " + strconv.Itoa(protocolNumber&^SnapshotBit)
+	}
+
+	return Future
+}
+
+// Latest returns the newest release that is not a snapshot.
+func (r *Registry) Latest() Release {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	for i := len(r.releases) - 1; i >= 0; i-- {
+		if !r.releases[i].Snapshot && r.releases[i].Protocol&SnapshotBit == 0 {
+			return r.releases[i]
+		}
+	}
+
+	return Release{}
+}
+
+// Releases returns all of the releases in the registry, ordered by
+// protocol number.
+func (r *Registry) Releases() []Release {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return append([]Release(nil), r.releases...)
+}
+
+func (r *Registry) search(protocolNumber int) int {
+	return sort.Search(len(r.releases), func(i int) bool {
+		return r.releases[i].Protocol >= protocolNumber
+	})
+}
+
+// IsSnapshot returns whether the protocol number belongs to a snapshot,
+// either because of SnapshotBit or because it is registered as one in the
+// Default registry.
+func IsSnapshot(protocolNumber int) bool {
+	if protocolNumber&SnapshotBit != 0 {
+		return true
+	}
+
+	release, found := Default.Lookup(protocolNumber)
+	return found && release.Snapshot
+}
+
+// AtLeast returns whether a client using protocolNumber is at least as new
+// as the release using target, which is used to gate features by version.
+// Snapshots with SnapshotBit set are newer than every release.
+func AtLeast(protocolNumber int, target int) bool {
+	if protocolNumber&SnapshotBit != 0 {
+		return target&SnapshotBit == 0 || protocolNumber >= target
+	}
+
+	if target&SnapshotBit != 0 {
+		return false
+	}
+
+	return protocolNumber >= target
+}
+
+// Lookup returns the release with the exact given protocol number from the
+// Default registry.
+func Lookup(protocolNumber int) (Release, bool) {
+	return Default.Lookup(protocolNumber)
+}
+
+// Name returns the release name for a protocol version number from the
+// Default registry. See Registry.Name.
+func Name(protocolNumber int) string {
+	return Default.Name(protocolNumber)
+}
+
+// Register adds releases to the Default registry.
+func Register(releases ...Release) {
+	Default.Register(releases...)
+}
+
+// Load registers the JSON array of releases read from rd into the Default
+// registry, overriding bundled releases with the same protocol number.
+func Load(rd io.Reader) error {
+	return Default.Load(rd)
+}
+
+// LoadFile registers the releases in the JSON file at path into the Default
+// registry.
+func LoadFile(path string) error {
+	return Default.LoadFile(path)
+}